@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 	"kutil/internal/kctx"
@@ -12,6 +14,11 @@ func main() {
 	rootCmd := &cobra.Command{
 		Use:   "kctx",
 		Short: "Kubernetes context utility",
+		Long: `Kubernetes context utility.
+
+Running kctx without a command opens the interactive context picker when
+stdout is a terminal.`,
+		Run: rootCommand,
 	}
 
 	lsCmd := &cobra.Command{
@@ -20,6 +27,42 @@ func main() {
 		Run:   lsContexts,
 	}
 
+	pickCmd := &cobra.Command{
+		Use:   "pick",
+		Short: "Interactively pick a context with fuzzy filtering",
+		Long:  "Open a filterable list of contexts and switch to the highlighted one on Enter",
+		Args:  cobra.NoArgs,
+		Run:   pickContext,
+	}
+
+	useCmd := &cobra.Command{
+		Use:   "use NAME",
+		Short: "Switch the current kubernetes context",
+		Long: `Switch the current kubernetes context.
+
+Usage:
+  kctx use NAME  Switch to the named context
+  kctx use -     Switch back to the previously used context`,
+		Args: cobra.ExactArgs(1),
+		Run:  useContext,
+	}
+
+	nsCmd := &cobra.Command{
+		Use:   "ns [NAME]",
+		Short: "Show or set the default namespace of a context",
+		Long: `Show or set the default namespace of the current context.
+
+Usage:
+  kctx ns       Show the default namespace
+  kctx ns NAME  Set the default namespace
+  kctx ns -     Switch back to the previously used namespace`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  nsContext,
+	}
+
+	nsCmd.Flags().String("context", "", "Context to show or modify (default: current context)")
+	nsCmd.Flags().Bool("validate", false, "Check that the namespace exists in the cluster before setting it")
+
 	trCmd := &cobra.Command{
 		Use:   "tr [INPUT_REGEX] [REPLACEMENT_VALUE]",
 		Short: "Transform context names using regex patterns",
@@ -27,13 +70,57 @@ func main() {
 
 Usage:
   kctx tr INPUT_REGEX REPLACEMENT_VALUE  Replace matched regex with replacement value
-  kctx tr -d DELETION_REGEX              Delete matched regex from context names`,
+  kctx tr -d DELETION_REGEX              Delete matched regex from context names
+
+By default only context names are transformed. Use --clusters and --users
+(or --all) to rename clusters and users as well; contexts referencing a
+renamed cluster or user are updated to match.`,
 		Args: cobra.MinimumNArgs(1),
 		Run:  trContexts,
 	}
 
 	trCmd.Flags().BoolP("delete", "d", false, "Delete matched regex instead of replacing")
 	trCmd.Flags().BoolP("force", "f", false, "Apply changes without confirmation prompt")
+	trCmd.Flags().Bool("contexts", false, "Rename contexts (default when no scope flag is given)")
+	trCmd.Flags().Bool("clusters", false, "Rename clusters and update the contexts that reference them")
+	trCmd.Flags().Bool("users", false, "Rename users and update the contexts that reference them")
+	trCmd.Flags().Bool("all", false, "Rename contexts, clusters and users")
+
+	rmCmd := &cobra.Command{
+		Use:   "rm [NAME...]",
+		Short: "Delete contexts by name or regex",
+		Long: `Delete contexts by name or regex.
+
+Usage:
+  kctx rm NAME...           Delete the named contexts
+  kctx rm --regex PATTERN   Delete contexts matching the regex
+
+The current context is only deleted with --current, in which case
+current-context is unset.`,
+		Run: rmContexts,
+	}
+
+	rmCmd.Flags().String("regex", "", "Delete contexts whose name matches this regex")
+	rmCmd.Flags().Bool("prune", false, "Also delete clusters and users no longer referenced by any context")
+	rmCmd.Flags().Bool("current", false, "Allow deleting the current context")
+	rmCmd.Flags().BoolP("force", "f", false, "Delete without confirmation prompt")
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove dangling clusters, users and broken contexts",
+		Long: `Find and remove dangling kubeconfig entries:
+  - contexts that reference a missing cluster or user
+  - clusters and users that no context references
+  - a current-context that names a missing context
+
+With --dry-run the findings are only reported and the command exits with
+status 1 if anything would be pruned, which makes it usable as a CI check.`,
+		Args: cobra.NoArgs,
+		Run:  pruneKubeconfig,
+	}
+
+	pruneCmd.Flags().Bool("dry-run", false, "Report what would be pruned without changing anything")
+	pruneCmd.Flags().BoolP("force", "f", false, "Apply changes without confirmation prompt")
 
 	grepCmd := &cobra.Command{
 		Use:   "grep REGEX",
@@ -45,14 +132,106 @@ Usage:
 
 	grepCmd.Flags().BoolP("invert-match", "v", false, "Show contexts that do NOT match the pattern")
 
+	importCmd := &cobra.Command{
+		Use:   "import FILE...",
+		Short: "Merge external kubeconfig files into the kubeconfig",
+		Long: `Merge the contexts, clusters and users of external kubeconfig files into
+the kubeconfig. Use "-" to read a kubeconfig from stdin.
+
+Entries whose name is already in use are handled by --conflict:
+  skip       Keep the existing entry (default)
+  overwrite  Replace the existing entry
+  rename     Import under a new name built with --prefix and/or
+             --rename REGEX --replacement VALUE
+
+A backup of the kubeconfig is created before any change is written.`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  importKubeconfigs,
+	}
+
+	importCmd.Flags().String("conflict", string(kctx.ConflictSkip), "How to handle name collisions: skip, overwrite or rename")
+	importCmd.Flags().String("prefix", "", "Prefix for renamed entries (implies --conflict rename)")
+	importCmd.Flags().String("rename", "", "Regex applied to the names of renamed entries (implies --conflict rename)")
+	importCmd.Flags().String("replacement", "", "Replacement value for --rename")
+	importCmd.Flags().BoolP("force", "f", false, "Apply changes without confirmation prompt")
+
+	exportCmd := &cobra.Command{
+		Use:   "export [NAME...]",
+		Short: "Write a standalone kubeconfig for selected contexts",
+		Long: `Write a standalone kubeconfig containing only the selected contexts and
+the clusters and users they reference.
+
+Usage:
+  kctx export NAME...           Export the named contexts
+  kctx export --regex PATTERN   Export contexts matching the regex`,
+		Run: exportContexts,
+	}
+
+	exportCmd.Flags().String("regex", "", "Export contexts whose name matches this regex")
+	exportCmd.Flags().StringP("output", "o", "", "Write to this file instead of stdout")
+	exportCmd.Flags().Bool("flatten", false, "Inline certificate and key files as data fields")
+	exportCmd.Flags().Bool("minify", false, "Strip preferences and extensions")
+
 	backupCmd := &cobra.Command{
 		Use:   "backup",
+		Short: "Create and manage timestamped backups of the kubeconfig file",
+		Long: `Create a backup copy of the kubeconfig file with a timestamp suffix.
+
+Use the subcommands to list, restore, prune and diff existing backups.`,
+		Args: cobra.NoArgs,
+		Run:  backupKubeconfig,
+	}
+
+	backupCreateCmd := &cobra.Command{
+		Use:   "create",
 		Short: "Create a timestamped backup of the kubeconfig file",
-		Long:  "Create a backup copy of the kubeconfig file with a timestamp suffix",
+		Args:  cobra.NoArgs,
 		Run:   backupKubeconfig,
 	}
 
-	rootCmd.AddCommand(lsCmd, trCmd, grepCmd, backupCmd)
+	backupListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List kubeconfig backups with their age and context count",
+		Args:  cobra.NoArgs,
+		Run:   listBackups,
+	}
+
+	backupRestoreCmd := &cobra.Command{
+		Use:   "restore [ID]",
+		Short: "Restore the kubeconfig from a backup (default: newest)",
+		Long:  "Replace the kubeconfig file with a backup. The current file is backed up first.",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   restoreBackup,
+	}
+
+	backupRestoreCmd.Flags().BoolP("force", "f", false, "Restore without confirmation prompt")
+
+	backupPruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete old kubeconfig backups",
+		Long: `Delete old kubeconfig backups.
+
+A backup is deleted only if it matches every given criterion: it is not
+among the --keep newest backups and it is older than --older-than.`,
+		Args: cobra.NoArgs,
+		Run:  pruneBackups,
+	}
+
+	backupPruneCmd.Flags().Int("keep", 0, "Number of newest backups to keep")
+	backupPruneCmd.Flags().String("older-than", "", "Only delete backups older than this duration (e.g. 72h, 30d)")
+	backupPruneCmd.Flags().BoolP("force", "f", false, "Delete without confirmation prompt")
+
+	backupDiffCmd := &cobra.Command{
+		Use:   "diff ID",
+		Short: "Show what changed in the kubeconfig since a backup",
+		Long:  "Show which contexts, clusters and users were added (+), removed (-) or changed (~) since the backup",
+		Args:  cobra.ExactArgs(1),
+		Run:   diffBackup,
+	}
+
+	backupCmd.AddCommand(backupCreateCmd, backupListCmd, backupRestoreCmd, backupPruneCmd, backupDiffCmd)
+
+	rootCmd.AddCommand(lsCmd, pickCmd, useCmd, nsCmd, trCmd, rmCmd, pruneCmd, importCmd, exportCmd, grepCmd, backupCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -60,6 +239,22 @@ Usage:
 	}
 }
 
+func rootCommand(cmd *cobra.Command, _ []string) {
+	if !isTerminal(os.Stdout) {
+		_ = cmd.Help()
+		return
+	}
+	pickContext(cmd, nil)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
 func lsContexts(_ *cobra.Command, _ []string) {
 	if err := kctx.ListContexts(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -67,9 +262,41 @@ func lsContexts(_ *cobra.Command, _ []string) {
 	}
 }
 
+func pickContext(_ *cobra.Command, _ []string) {
+	if err := kctx.PickContext(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func useContext(_ *cobra.Command, args []string) {
+	if err := kctx.UseContext(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func nsContext(cmd *cobra.Command, args []string) {
+	contextName, _ := cmd.Flags().GetString("context")
+	validate, _ := cmd.Flags().GetBool("validate")
+
+	var err error
+	if len(args) == 0 {
+		err = kctx.ShowNamespace(contextName)
+	} else {
+		err = kctx.UseNamespace(contextName, args[0], validate)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 func trContexts(cmd *cobra.Command, args []string) {
 	deleteMode, _ := cmd.Flags().GetBool("delete")
 	force, _ := cmd.Flags().GetBool("force")
+	scope := trScope(cmd)
 
 	var err error
 	if deleteMode {
@@ -77,13 +304,13 @@ func trContexts(cmd *cobra.Command, args []string) {
 			fmt.Fprintf(os.Stderr, "Error: delete mode requires exactly one regex argument\n")
 			os.Exit(1)
 		}
-		err = kctx.DeleteFromContexts(args[0], force)
+		err = kctx.DeleteFromContexts(args[0], scope, force)
 	} else {
 		if len(args) != 2 {
 			fmt.Fprintf(os.Stderr, "Error: replace mode requires exactly two arguments: INPUT_REGEX REPLACEMENT_VALUE\n")
 			os.Exit(1)
 		}
-		err = kctx.ReplaceInContexts(args[0], args[1], force)
+		err = kctx.ReplaceInContexts(args[0], args[1], scope, force)
 	}
 
 	if err != nil {
@@ -92,6 +319,62 @@ func trContexts(cmd *cobra.Command, args []string) {
 	}
 }
 
+func trScope(cmd *cobra.Command) kctx.Scope {
+	contexts, _ := cmd.Flags().GetBool("contexts")
+	clusters, _ := cmd.Flags().GetBool("clusters")
+	users, _ := cmd.Flags().GetBool("users")
+	all, _ := cmd.Flags().GetBool("all")
+
+	if all {
+		return kctx.Scope{Contexts: true, Clusters: true, Users: true}
+	}
+	if !contexts && !clusters && !users {
+		contexts = true
+	}
+	return kctx.Scope{Contexts: contexts, Clusters: clusters, Users: users}
+}
+
+func rmContexts(cmd *cobra.Command, args []string) {
+	regex, _ := cmd.Flags().GetString("regex")
+	prune, _ := cmd.Flags().GetBool("prune")
+	current, _ := cmd.Flags().GetBool("current")
+	force, _ := cmd.Flags().GetBool("force")
+
+	var err error
+	if regex != "" {
+		if len(args) != 0 {
+			fmt.Fprintf(os.Stderr, "Error: context names cannot be combined with --regex\n")
+			os.Exit(1)
+		}
+		err = kctx.RemoveContextsByRegex(regex, current, force, prune)
+	} else {
+		if len(args) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: specify at least one context name or --regex\n")
+			os.Exit(1)
+		}
+		err = kctx.RemoveContexts(args, current, force, prune)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func pruneKubeconfig(cmd *cobra.Command, _ []string) {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	force, _ := cmd.Flags().GetBool("force")
+
+	err := kctx.Prune(dryRun, force)
+	if errors.Is(err, kctx.ErrPruneNeeded) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 func grepContexts(cmd *cobra.Command, args []string) {
 	regex := args[0]
 	invertMatch, _ := cmd.Flags().GetBool("invert-match")
@@ -102,9 +385,107 @@ func grepContexts(cmd *cobra.Command, args []string) {
 	}
 }
 
+func importKubeconfigs(cmd *cobra.Command, args []string) {
+	conflict, _ := cmd.Flags().GetString("conflict")
+	prefix, _ := cmd.Flags().GetString("prefix")
+	rename, _ := cmd.Flags().GetString("rename")
+	replacement, _ := cmd.Flags().GetString("replacement")
+	force, _ := cmd.Flags().GetBool("force")
+
+	if !cmd.Flags().Changed("conflict") && (prefix != "" || rename != "") {
+		conflict = string(kctx.ConflictRename)
+	}
+
+	opts := kctx.ImportOptions{
+		Conflict:    kctx.ConflictStrategy(conflict),
+		Prefix:      prefix,
+		RenameRegex: rename,
+		Replacement: replacement,
+		Force:       force,
+	}
+
+	if err := kctx.ImportKubeconfigs(args, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func exportContexts(cmd *cobra.Command, args []string) {
+	regex, _ := cmd.Flags().GetString("regex")
+	output, _ := cmd.Flags().GetString("output")
+	flatten, _ := cmd.Flags().GetBool("flatten")
+	minify, _ := cmd.Flags().GetBool("minify")
+
+	if regex == "" && len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: specify at least one context name or --regex\n")
+		os.Exit(1)
+	}
+
+	opts := kctx.ExportOptions{
+		Regex:   regex,
+		Output:  output,
+		Flatten: flatten,
+		Minify:  minify,
+	}
+
+	if err := kctx.ExportContexts(args, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 func backupKubeconfig(_ *cobra.Command, _ []string) {
 	if err := kctx.BackupKubeconfig(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+func listBackups(_ *cobra.Command, _ []string) {
+	if err := kctx.ListBackups(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func restoreBackup(cmd *cobra.Command, args []string) {
+	force, _ := cmd.Flags().GetBool("force")
+
+	id := ""
+	if len(args) > 0 {
+		id = args[0]
+	}
+
+	if err := kctx.RestoreBackup(id, force); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func pruneBackups(cmd *cobra.Command, _ []string) {
+	keep, _ := cmd.Flags().GetInt("keep")
+	olderThanFlag, _ := cmd.Flags().GetString("older-than")
+	force, _ := cmd.Flags().GetBool("force")
+
+	var olderThan time.Duration
+	if olderThanFlag != "" {
+		var err error
+		olderThan, err = kctx.ParseAge(olderThanFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := kctx.PruneBackups(keep, olderThan, force); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func diffBackup(_ *cobra.Command, args []string) {
+	if err := kctx.DiffBackup(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
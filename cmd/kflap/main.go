@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"kutil/internal/kflap"
 
@@ -25,12 +26,61 @@ func main() {
 	}
 
 	// Add flags
-	resourcesCmd.Flags().StringP("resources", "r", "", "Comma-delimited list of resource types to monitor (default: all)")
-	resourcesCmd.Flags().IntP("interval", "i", 5, "Polling interval in seconds")
-	resourcesCmd.Flags().StringP("namespaces", "n", "", "Comma-delimited list of namespaces to monitor (default: all)")
-	resourcesCmd.Flags().IntP("limit", "l", 20, "Number of table rows to display")
+	addMonitorFlags(resourcesCmd)
+	resourcesCmd.Flags().IntP("limit", "l", 20, "Number of table rows to display (0 = all)")
+	resourcesCmd.Flags().Int("diffs", 0, "Number of recent field-level diffs kept per resource (implies --full-objects); values of Secret data are redacted")
+	resourcesCmd.Flags().String("ignore-paths", strings.Join(kflap.DefaultIgnorePaths, ","), "Comma-delimited list of field paths left out of diffs")
+	addOutputFlags(resourcesCmd)
+
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Export resource changes as Prometheus metrics",
+		Long:  "Monitor resources continuously and serve per-resource change counters and rates on /metrics in the Prometheus text format",
+		Run:   runServe,
+	}
+
+	addMonitorFlags(serveCmd)
+	serveCmd.Flags().String("listen", ":9090", "Address to serve metrics on")
+	serveCmd.Flags().Int("top", 100, "Number of most changed resources to export (0 = all)")
+	serveCmd.Flags().Int("max-series", 10000, "Maximum number of per-resource series to export (0 = no cap)")
+
+	replayCmd := &cobra.Command{
+		Use:   "replay FILE",
+		Short: "Replay a recorded session",
+		Long:  "Display the changes of a recording made with --record at the pace they were observed, optionally sped up",
+		Args:  cobra.ExactArgs(1),
+		Run:   runReplay,
+	}
+
+	replayCmd.Flags().Float64("speed", 1, "Replay speed relative to real time, e.g. 10 for ten times faster")
+	replayCmd.Flags().IntP("interval", "i", 1, "Refresh interval in seconds")
+	replayCmd.Flags().IntP("limit", "l", 20, "Number of table rows to display (0 = all)")
+	replayCmd.Flags().Int("diffs", 10, "Number of recent recorded diffs kept per resource")
+	replayCmd.Flags().String("sort", kflap.SortByChanges, "Sort rows by total changes, change rate over a window or change class: changes, 1m, 5m, 15m, spec, status, metadata")
+	replayCmd.Flags().Bool("hide-status", false, "Hide resources whose changes were all status-only")
+	replayCmd.Flags().String("rules", "", "YAML file with alert rules evaluated after each refresh")
+	addOutputFlags(replayCmd)
+
+	auditCmd := &cobra.Command{
+		Use:   "audit FILE...",
+		Short: "Analyze API server audit logs",
+		Long:  "Count the persisted updates and patches in API server audit logs, which may be rotated and gzipped, per resource and field manager",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   runAudit,
+	}
+
+	auditCmd.Flags().Float64("speed", 0, "Replay the logs at this speed relative to real time instead of showing the end result")
+	auditCmd.Flags().IntP("interval", "i", 1, "Refresh interval in seconds")
+	auditCmd.Flags().IntP("limit", "l", 20, "Number of table rows to display (0 = all)")
+	auditCmd.Flags().String("sort", kflap.SortByChanges, "Sort rows by total changes, change rate over a window or change class: changes, 1m, 5m, 15m, spec, status, metadata")
+	auditCmd.Flags().Bool("hide-status", false, "Hide resources whose changes were all status-only")
+	auditCmd.Flags().String("rules", "", "YAML file with alert rules evaluated after each refresh")
+	addOutputFlags(auditCmd)
 
 	rootCmd.AddCommand(resourcesCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(replayCmd)
+	rootCmd.AddCommand(auditCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -38,41 +88,265 @@ func main() {
 	}
 }
 
-func runResources(cmd *cobra.Command, args []string) {
+// addMonitorFlags adds the flags that configure what is monitored and how
+func addMonitorFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("context", nil, "Kubeconfig context to monitor, repeatable to monitor several clusters (default: current context)")
+	cmd.Flags().Bool("all-contexts", false, "Monitor the clusters of all kubeconfig contexts")
+	cmd.Flags().String("context-regex", "", "Monitor the clusters of the kubeconfig contexts matching this regular expression")
+	cmd.Flags().StringP("resources", "r", "", "Comma-delimited list of resource types to monitor (default: all)")
+	cmd.Flags().IntP("interval", "i", 5, "Polling interval in seconds")
+	cmd.Flags().StringP("namespaces", "n", "", "Comma-delimited list of namespaces to monitor (default: all)")
+	cmd.Flags().String("selector", "", "Label selector to filter objects by, e.g. app=web,tier!=cache (unlike kubectl there is no -l shorthand, as -l is --limit)")
+	cmd.Flags().String("field-selector", "", "Field selector to filter objects by, e.g. metadata.name=web (fields other than metadata.name and metadata.namespace are resource specific)")
+	cmd.Flags().String("exclude-resources", "", "Comma-delimited list of resource types to leave out, as globs or /regex/ (e.g. leases,events,*.metrics.k8s.io)")
+	cmd.Flags().String("exclude-namespaces", "", "Comma-delimited list of namespaces to leave out, as globs or /regex/ (e.g. kube-*,/-system$/)")
+	cmd.Flags().BoolP("watch", "w", false, "Watch resources for every change instead of re-listing on each poll")
+	cmd.Flags().Int64("page-size", 500, "Number of objects fetched per list request (0 disables pagination)")
+	cmd.Flags().Int("workers", 8, "Number of lists fetched concurrently when polling")
+	cmd.Flags().Float32("qps", 20, "Client-side limit of requests per second to each cluster")
+	cmd.Flags().Int("burst", 40, "Client-side burst of requests to each cluster above --qps")
+	cmd.Flags().Duration("request-timeout", 30*time.Second, "Timeout of each list request when polling (0 = none)")
+	cmd.Flags().Bool("full-objects", false, "Fetch full objects instead of metadata only")
+	cmd.Flags().String("sort", kflap.SortByChanges, "Sort rows by total changes, change rate over a window or change class: changes, 1m, 5m, 15m, spec, status, metadata")
+	cmd.Flags().Bool("oscillation", false, "Detect resources returning to a previously seen state and flag them as flapping (implies --full-objects)")
+	cmd.Flags().Bool("hash-status", false, "Include status when comparing states for oscillation detection")
+	cmd.Flags().Bool("fights", false, "Detect field managers repeatedly taking the same fields from each other (keeps the managed fields of every object in memory)")
+	cmd.Flags().Bool("hide-status", false, "Hide resources whose changes were all status-only")
+	cmd.Flags().String("rules", "", "YAML file with alert rules evaluated after each poll")
+	cmd.Flags().String("record", "", "Append every observed change to this file for later replay")
+}
+
+// addOutputFlags adds the flags for printing snapshots instead of running
+// the TUI
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", "", "Print snapshots instead of running the TUI: json, ndjson, csv, table")
+	cmd.Flags().Duration("duration", 0, "With --output, print a single snapshot after this long instead of one per poll")
+}
+
+// monitorConfig builds a config from the flags added by addMonitorFlags
+func monitorConfig(cmd *cobra.Command) kflap.Config {
 	// Parse flags
+	contextNames, _ := cmd.Flags().GetStringArray("context")
+	allContexts, _ := cmd.Flags().GetBool("all-contexts")
+	contextRegex, _ := cmd.Flags().GetString("context-regex")
 	resourcesFlag, _ := cmd.Flags().GetString("resources")
 	interval, _ := cmd.Flags().GetInt("interval")
 	namespacesFlag, _ := cmd.Flags().GetString("namespaces")
+	selector, _ := cmd.Flags().GetString("selector")
+	fieldSelector, _ := cmd.Flags().GetString("field-selector")
+	excludeResourcesFlag, _ := cmd.Flags().GetString("exclude-resources")
+	excludeNamespacesFlag, _ := cmd.Flags().GetString("exclude-namespaces")
+	watch, _ := cmd.Flags().GetBool("watch")
+	pageSize, _ := cmd.Flags().GetInt64("page-size")
+	workers, _ := cmd.Flags().GetInt("workers")
+	qps, _ := cmd.Flags().GetFloat32("qps")
+	burst, _ := cmd.Flags().GetInt("burst")
+	requestTimeout, _ := cmd.Flags().GetDuration("request-timeout")
+	fullObjects, _ := cmd.Flags().GetBool("full-objects")
+	sortBy, _ := cmd.Flags().GetString("sort")
+	oscillation, _ := cmd.Flags().GetBool("oscillation")
+	hashStatus, _ := cmd.Flags().GetBool("hash-status")
+	fights, _ := cmd.Flags().GetBool("fights")
+	hideStatus, _ := cmd.Flags().GetBool("hide-status")
+	record, _ := cmd.Flags().GetString("record")
+
+	if err := kflap.ValidateSortKey(sortBy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if interval < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --interval must be at least 1\n")
+		os.Exit(1)
+	}
+	if workers < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --workers must be at least 1\n")
+		os.Exit(1)
+	}
+	contexts, err := kflap.ResolveContexts(contextNames, allContexts, contextRegex)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	return kflap.Config{
+		Contexts:          contexts,
+		Resources:         splitList(resourcesFlag),
+		Namespaces:        splitList(namespacesFlag),
+		LabelSelector:     selector,
+		FieldSelector:     fieldSelector,
+		ExcludeResources:  splitList(excludeResourcesFlag),
+		ExcludeNamespaces: splitList(excludeNamespacesFlag),
+		Interval:          interval,
+		Watch:             watch,
+		PageSize:          pageSize,
+		Workers:           workers,
+		QPS:               qps,
+		Burst:             burst,
+		RequestTimeout:    requestTimeout,
+		FullObjects:       fullObjects,
+		SortBy:            sortBy,
+		Oscillation:       oscillation,
+		HashStatus:        hashStatus,
+		Fights:            fights,
+		HideStatusOnly:    hideStatus,
+		Rules:             loadRules(cmd),
+		Record:            record,
+	}
+}
+
+// loadRules loads the alert rules named by the --rules flag, if any
+func loadRules(cmd *cobra.Command) []kflap.Rule {
+	rulesFile, _ := cmd.Flags().GetString("rules")
+	if rulesFile == "" {
+		return nil
+	}
+
+	rules, err := kflap.LoadRules(rulesFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return rules
+}
+
+func runResources(cmd *cobra.Command, args []string) {
+	config := monitorConfig(cmd)
+
 	limit, _ := cmd.Flags().GetInt("limit")
+	diffs, _ := cmd.Flags().GetInt("diffs")
+	ignorePathsFlag, _ := cmd.Flags().GetString("ignore-paths")
 
-	// Parse comma-delimited values
-	var resources []string
-	if resourcesFlag != "" {
-		resources = strings.Split(resourcesFlag, ",")
-		for i := range resources {
-			resources[i] = strings.TrimSpace(resources[i])
-		}
+	config.Limit = limit
+	config.Diffs = diffs
+	config.IgnorePaths = splitList(ignorePathsFlag)
+
+	runWithOutput(cmd, config)
+}
+
+func runReplay(cmd *cobra.Command, args []string) {
+	speed, _ := cmd.Flags().GetFloat64("speed")
+	interval, _ := cmd.Flags().GetInt("interval")
+	limit, _ := cmd.Flags().GetInt("limit")
+	diffs, _ := cmd.Flags().GetInt("diffs")
+	sortBy, _ := cmd.Flags().GetString("sort")
+	hideStatus, _ := cmd.Flags().GetBool("hide-status")
+
+	if speed <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --speed must be positive\n")
+		os.Exit(1)
+	}
+	if interval < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --interval must be at least 1\n")
+		os.Exit(1)
+	}
+	if err := kflap.ValidateSortKey(sortBy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	var namespaces []string
-	if namespacesFlag != "" {
-		namespaces = strings.Split(namespacesFlag, ",")
-		for i := range namespaces {
-			namespaces[i] = strings.TrimSpace(namespaces[i])
-		}
+	config := kflap.Config{
+		Replay:         args[0],
+		Speed:          speed,
+		Interval:       interval,
+		Limit:          limit,
+		Diffs:          diffs,
+		SortBy:         sortBy,
+		HideStatusOnly: hideStatus,
+		Rules:          loadRules(cmd),
+	}
+
+	runWithOutput(cmd, config)
+}
+
+func runAudit(cmd *cobra.Command, args []string) {
+	speed, _ := cmd.Flags().GetFloat64("speed")
+	interval, _ := cmd.Flags().GetInt("interval")
+	limit, _ := cmd.Flags().GetInt("limit")
+	sortBy, _ := cmd.Flags().GetString("sort")
+	hideStatus, _ := cmd.Flags().GetBool("hide-status")
+
+	if speed < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --speed must not be negative\n")
+		os.Exit(1)
+	}
+	if interval < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --interval must be at least 1\n")
+		os.Exit(1)
+	}
+	if err := kflap.ValidateSortKey(sortBy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	// Create config
 	config := kflap.Config{
-		Resources:  resources,
-		Namespaces: namespaces,
-		Interval:   interval,
-		Limit:      limit,
+		AuditLogs:      args,
+		Speed:          speed,
+		Interval:       interval,
+		Limit:          limit,
+		SortBy:         sortBy,
+		HideStatusOnly: hideStatus,
+		Rules:          loadRules(cmd),
 	}
 
-	// Run the TUI
-	if err := kflap.Run(config); err != nil {
+	runWithOutput(cmd, config)
+}
+
+// runWithOutput runs the TUI, or prints snapshots when an output format is
+// given with the flags added by addOutputFlags
+func runWithOutput(cmd *cobra.Command, config kflap.Config) {
+	output, _ := cmd.Flags().GetString("output")
+	duration, _ := cmd.Flags().GetDuration("duration")
+
+	if output != "" {
+		if err := kflap.ValidateOutput(output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if duration > 0 {
+		fmt.Fprintf(os.Stderr, "Error: --duration requires --output\n")
+		os.Exit(1)
+	}
+
+	config.Output = output
+	config.Duration = duration
+
+	var err error
+	if output != "" {
+		err = kflap.RunHeadless(config, os.Stdout)
+	} else {
+		err = kflap.Run(config)
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+func runServe(cmd *cobra.Command, args []string) {
+	config := monitorConfig(cmd)
+
+	listen, _ := cmd.Flags().GetString("listen")
+	top, _ := cmd.Flags().GetInt("top")
+	maxSeries, _ := cmd.Flags().GetInt("max-series")
+
+	config.Listen = listen
+	config.Limit = top
+	config.MaxSeries = maxSeries
+
+	if err := kflap.Serve(config); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// splitList parses a comma-delimited flag value, returning nil when empty
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
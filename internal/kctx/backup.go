@@ -4,43 +4,455 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
+const (
+	backupInfix = "_backup_"
+
+	// backupIDFormat names new backups; legacyBackupIDFormat is the
+	// minute-resolution format used by older versions
+	backupIDFormat       = "20060102150405"
+	legacyBackupIDFormat = "200601021504"
+)
+
+// Backup is a backup copy of the kubeconfig file
+type Backup struct {
+	ID      string
+	Path    string
+	Created time.Time
+}
+
 func BackupKubeconfig() error {
+	kubeconfigPath, err := defaultKubeconfigPath()
+	if err != nil {
+		return err
+	}
+
+	backupPath, err := createBackup(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Backup created: %s\n", backupPath)
+	return nil
+}
+
+// ListBackups prints the backups of the kubeconfig file, newest first
+func ListBackups() error {
+	kubeconfigPath, err := defaultKubeconfigPath()
+	if err != nil {
+		return err
+	}
+
+	backups, err := findBackups(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+
+	if len(backups) == 0 {
+		fmt.Printf("No backups found for %s\n", kubeconfigPath)
+		return nil
+	}
+
+	fmt.Printf("%-20s %-20s %-8s %s\n", "ID", "CREATED", "AGE", "CONTEXTS")
+	now := time.Now()
+	for _, backup := range backups {
+		contexts := "?"
+		if config, err := clientcmd.LoadFromFile(backup.Path); err == nil {
+			contexts = strconv.Itoa(len(config.Contexts))
+		}
+		fmt.Printf("%-20s %-20s %-8s %s\n",
+			backup.ID,
+			backup.Created.Format("2006-01-02 15:04:05"),
+			formatAge(now.Sub(backup.Created)),
+			contexts,
+		)
+	}
+
+	return nil
+}
+
+// RestoreBackup replaces the kubeconfig file with the backup id, or with the
+// newest backup when id is empty. The current file is backed up first.
+func RestoreBackup(id string, force bool) error {
+	kubeconfigPath, err := defaultKubeconfigPath()
+	if err != nil {
+		return err
+	}
+
+	backup, err := resolveBackup(kubeconfigPath, id)
+	if err != nil {
+		return err
+	}
+
+	if !force && !confirmChanges(fmt.Sprintf("Restore backup %s over %s?", backup.ID, kubeconfigPath)) {
+		fmt.Println("Operation cancelled.")
+		return nil
+	}
+
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(kubeconfigPath); err == nil {
+		mode = info.Mode().Perm()
+
+		backupPath, err := createBackup(kubeconfigPath)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup created: %s\n", backupPath)
+	}
+
+	if err := copyFile(backup.Path, kubeconfigPath, mode, false); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %s from backup %s\n", kubeconfigPath, backup.ID)
+	return nil
+}
+
+// PruneBackups deletes old backups. A backup is deleted only if it matches
+// every given criterion: it is not among the keep newest backups (when keep
+// is positive) and it is older than olderThan (when olderThan is positive).
+func PruneBackups(keep int, olderThan time.Duration, force bool) error {
+	if keep <= 0 && olderThan <= 0 {
+		return fmt.Errorf("specify --keep and/or --older-than")
+	}
+
+	kubeconfigPath, err := defaultKubeconfigPath()
+	if err != nil {
+		return err
+	}
+
+	backups, err := findBackups(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var doomed []Backup
+	for i, backup := range backups {
+		if keep > 0 && i < keep {
+			continue
+		}
+		if olderThan > 0 && now.Sub(backup.Created) <= olderThan {
+			continue
+		}
+		doomed = append(doomed, backup)
+	}
+
+	if len(doomed) == 0 {
+		fmt.Println("No backups to prune")
+		return nil
+	}
+
+	fmt.Println("Backups:")
+	for _, backup := range doomed {
+		fmt.Printf("  - %s (%s old)\n", backup.ID, formatAge(now.Sub(backup.Created)))
+	}
+
+	if !force && !confirmChanges(fmt.Sprintf("Delete %d backup(s)?", len(doomed))) {
+		fmt.Println("Operation cancelled.")
+		return nil
+	}
+
+	for _, backup := range doomed {
+		if err := os.Remove(backup.Path); err != nil {
+			return fmt.Errorf("error deleting backup %s: %v", backup.ID, err)
+		}
+	}
+
+	fmt.Printf("Successfully deleted %d backup(s)\n", len(doomed))
+	return nil
+}
+
+// DiffBackup shows which contexts, clusters and users were added, removed
+// or changed in the kubeconfig file since the backup id was taken
+func DiffBackup(id string) error {
+	kubeconfigPath, err := defaultKubeconfigPath()
+	if err != nil {
+		return err
+	}
+
+	backup, err := resolveBackup(kubeconfigPath, id)
+	if err != nil {
+		return err
+	}
+
+	before, err := clientcmd.LoadFromFile(backup.Path)
+	if err != nil {
+		return fmt.Errorf("error loading backup %s: %v", backup.ID, err)
+	}
+	after, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+	clearOrigins(before)
+	clearOrigins(after)
+
+	changed := false
+	changed = printEntryDiff("Contexts", before.Contexts, after.Contexts) || changed
+	changed = printEntryDiff("Clusters", before.Clusters, after.Clusters) || changed
+	changed = printEntryDiff("Users", before.AuthInfos, after.AuthInfos) || changed
+
+	if before.CurrentContext != after.CurrentContext {
+		fmt.Println("Current context:")
+		fmt.Printf("  ~ %s -> %s\n", orNone(before.CurrentContext), orNone(after.CurrentContext))
+		changed = true
+	}
+
+	if !changed {
+		fmt.Printf("No changes since backup %s\n", backup.ID)
+	}
+	return nil
+}
+
+func defaultKubeconfigPath() (string, error) {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	kubeconfigPath := loadingRules.GetDefaultFilename()
 
 	if kubeconfigPath == "" {
-		return fmt.Errorf("could not determine kubeconfig file path")
+		return "", fmt.Errorf("could not determine kubeconfig file path")
 	}
+	return kubeconfigPath, nil
+}
 
-	if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
-		return fmt.Errorf("kubeconfig file does not exist at %s", kubeconfigPath)
+// backupFiles backs up each existing file of paths once, for changes that
+// are written to several files of a multi-file KUBECONFIG
+func backupFiles(paths []string) error {
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		backupPath, err := createBackup(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup created: %s\n", backupPath)
+	}
+	return nil
+}
+
+// createBackup copies kubeconfigPath to a new backup file named after the
+// current time, adding a counter if a backup with that name already exists,
+// and returns the backup's path
+func createBackup(kubeconfigPath string) (string, error) {
+	info, err := os.Stat(kubeconfigPath)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("kubeconfig file does not exist at %s", kubeconfigPath)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading kubeconfig file: %v", err)
 	}
 
-	timestamp := time.Now().Format("200601021504")
-	backupPath := kubeconfigPath + "_backup_" + timestamp
+	timestamp := time.Now().Format(backupIDFormat)
+	backupPath := kubeconfigPath + backupInfix + timestamp
+	for i := 1; ; i++ {
+		err := copyFile(kubeconfigPath, backupPath, info.Mode().Perm(), true)
+		if err == nil {
+			return backupPath, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		backupPath = fmt.Sprintf("%s%s%s-%d", kubeconfigPath, backupInfix, timestamp, i)
+	}
+}
 
-	sourceFile, err := os.Open(kubeconfigPath)
+// copyFile copies src to dst with the given permissions. With exclusive the
+// copy fails with an os.IsExist error if dst already exists.
+func copyFile(src, dst string, mode os.FileMode, exclusive bool) error {
+	sourceFile, err := os.Open(src)
 	if err != nil {
-		return fmt.Errorf("error opening kubeconfig file: %v", err)
+		return fmt.Errorf("error opening %s: %v", src, err)
 	}
 	defer sourceFile.Close()
 
-	destFile, err := os.Create(backupPath)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if exclusive {
+		flags |= os.O_EXCL
+	}
+	destFile, err := os.OpenFile(dst, flags, mode)
 	if err != nil {
-		return fmt.Errorf("error creating backup file: %v", err)
+		if os.IsExist(err) {
+			return err
+		}
+		return fmt.Errorf("error creating %s: %v", dst, err)
 	}
 	defer destFile.Close()
 
-	_, err = io.Copy(destFile, sourceFile)
-	if err != nil {
+	if _, err := io.Copy(destFile, sourceFile); err != nil {
 		return fmt.Errorf("error copying file: %v", err)
 	}
 
-	fmt.Printf("Backup created: %s\n", backupPath)
+	// OpenFile applies the umask and leaves existing files' modes alone
+	if err := destFile.Chmod(mode); err != nil {
+		return fmt.Errorf("error setting mode of %s: %v", dst, err)
+	}
 	return nil
 }
+
+// findBackups returns the backups of kubeconfigPath, newest first
+func findBackups(kubeconfigPath string) ([]Backup, error) {
+	matches, err := filepath.Glob(kubeconfigPath + backupInfix + "*")
+	if err != nil {
+		return nil, fmt.Errorf("error listing backups: %v", err)
+	}
+
+	prefix := kubeconfigPath + backupInfix
+	var backups []Backup
+	for _, path := range matches {
+		id := strings.TrimPrefix(path, prefix)
+		created, ok := parseBackupID(id)
+		if !ok {
+			continue
+		}
+		backups = append(backups, Backup{ID: id, Path: path, Created: created})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].Created.Equal(backups[j].Created) {
+			return backups[i].Created.After(backups[j].Created)
+		}
+		return backupCounter(backups[i].ID) > backupCounter(backups[j].ID)
+	})
+	return backups, nil
+}
+
+// resolveBackup finds the backup with the given id, or the newest backup
+// when id is empty
+func resolveBackup(kubeconfigPath, id string) (Backup, error) {
+	backups, err := findBackups(kubeconfigPath)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	if len(backups) == 0 {
+		return Backup{}, fmt.Errorf("no backups found for %s", kubeconfigPath)
+	}
+	if id == "" {
+		return backups[0], nil
+	}
+
+	for _, backup := range backups {
+		if backup.ID == id {
+			return backup, nil
+		}
+	}
+	return Backup{}, fmt.Errorf("backup '%s' not found; run 'kctx backup list' to see available backups", id)
+}
+
+// parseBackupID parses "TIMESTAMP" or "TIMESTAMP-N" in either the current or
+// the legacy timestamp format
+func parseBackupID(id string) (time.Time, bool) {
+	timestamp, _, _ := strings.Cut(id, "-")
+	for _, layout := range []string{backupIDFormat, legacyBackupIDFormat} {
+		if len(timestamp) != len(layout) {
+			continue
+		}
+		if created, err := time.ParseInLocation(layout, timestamp, time.Local); err == nil {
+			return created, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func backupCounter(id string) int {
+	_, counter, found := strings.Cut(id, "-")
+	if !found {
+		return 0
+	}
+	n, _ := strconv.Atoi(counter)
+	return n
+}
+
+// ParseAge parses a duration like time.ParseDuration, additionally
+// accepting a whole number of days such as "7d"
+func ParseAge(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration '%s'", s)
+	}
+	return d, nil
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+func clearOrigins(config *clientcmdapi.Config) {
+	for _, context := range config.Contexts {
+		context.LocationOfOrigin = ""
+	}
+	for _, cluster := range config.Clusters {
+		cluster.LocationOfOrigin = ""
+	}
+	for _, authInfo := range config.AuthInfos {
+		authInfo.LocationOfOrigin = ""
+	}
+}
+
+// printEntryDiff prints the entries added, removed and changed between
+// before and after, and reports whether there were any
+func printEntryDiff[V any](title string, before, after map[string]V) bool {
+	var lines []string
+	for _, name := range sortedKeys(after) {
+		old, existed := before[name]
+		if !existed {
+			lines = append(lines, "  + "+name)
+		} else if !reflect.DeepEqual(old, after[name]) {
+			lines = append(lines, "  ~ "+name)
+		}
+	}
+	for _, name := range sortedKeys(before) {
+		if _, exists := after[name]; !exists {
+			lines = append(lines, "  - "+name)
+		}
+	}
+
+	if len(lines) == 0 {
+		return false
+	}
+	fmt.Printf("%s:\n", title)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	return true
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
@@ -0,0 +1,49 @@
+package kctx
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBackupID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want time.Time
+		ok   bool
+	}{
+		{id: "20240102030405", want: time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local), ok: true},
+		{id: "20240102030405-2", want: time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local), ok: true},
+		{id: "202401020304", want: time.Date(2024, 1, 2, 3, 4, 0, 0, time.Local), ok: true},
+		{id: "202401020304-1", want: time.Date(2024, 1, 2, 3, 4, 0, 0, time.Local), ok: true},
+		{id: "2024010203", ok: false},
+		{id: "20241302030405", ok: false},
+		{id: "latest", ok: false},
+		{id: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, ok := parseBackupID(tt.id)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("parseBackupID(%q) = %v, %v, want %v, %v", tt.id, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBackupCounter(t *testing.T) {
+	tests := []struct {
+		id   string
+		want int
+	}{
+		{id: "20240102030405", want: 0},
+		{id: "20240102030405-1", want: 1},
+		{id: "20240102030405-12", want: 12},
+	}
+
+	for _, tt := range tests {
+		if got := backupCounter(tt.id); got != tt.want {
+			t.Errorf("backupCounter(%q) = %d, want %d", tt.id, got, tt.want)
+		}
+	}
+}
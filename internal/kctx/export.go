@@ -0,0 +1,138 @@
+package kctx
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ExportOptions configures ExportContexts
+type ExportOptions struct {
+	Regex   string // Select contexts matching this regex instead of by name
+	Output  string // File to write; empty writes to stdout
+	Flatten bool   // Inline certificate and key files as data fields
+	Minify  bool   // Drop preferences and extensions
+}
+
+// ExportContexts writes a standalone kubeconfig containing only the
+// selected contexts and the clusters and users they reference.
+func ExportContexts(names []string, opts ExportOptions) error {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	configOverrides := &clientcmd.ConfigOverrides{}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+
+	if opts.Regex != "" {
+		re, err := regexp.Compile(opts.Regex)
+		if err != nil {
+			return fmt.Errorf("error compiling regex '%s': %v", opts.Regex, err)
+		}
+		for contextName := range rawConfig.Contexts {
+			if re.MatchString(contextName) {
+				names = append(names, contextName)
+			}
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("no contexts matched regex: %s", opts.Regex)
+		}
+	}
+
+	exported, err := extractContexts(&rawConfig, uniqueSorted(names))
+	if err != nil {
+		return err
+	}
+
+	if opts.Flatten {
+		if err := clientcmdapi.FlattenConfig(exported); err != nil {
+			return fmt.Errorf("error flattening kubeconfig: %v", err)
+		}
+	}
+
+	if opts.Minify {
+		minifyConfig(exported)
+	}
+
+	if opts.Output == "" {
+		data, err := clientcmd.Write(*exported)
+		if err != nil {
+			return fmt.Errorf("error encoding kubeconfig: %v", err)
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if _, err := os.Stat(opts.Output); err == nil {
+		return fmt.Errorf("output file %s already exists", opts.Output)
+	}
+	if err := clientcmd.WriteToFile(*exported, opts.Output); err != nil {
+		return fmt.Errorf("error writing %s: %v", opts.Output, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %s to %s\n", describeCounts(map[string]int{
+		"context": len(exported.Contexts),
+		"cluster": len(exported.Clusters),
+		"user":    len(exported.AuthInfos),
+	}), opts.Output)
+	return nil
+}
+
+// extractContexts builds a new config holding the named contexts of config
+// and the clusters and users they reference. current-context is kept if it
+// is among the exported contexts and otherwise set to the first of them.
+func extractContexts(config *clientcmdapi.Config, names []string) (*clientcmdapi.Config, error) {
+	exported := clientcmdapi.NewConfig()
+	exported.Preferences = config.Preferences
+	exported.Extensions = config.Extensions
+
+	for _, name := range names {
+		context, exists := config.Contexts[name]
+		if !exists {
+			return nil, fmt.Errorf("context '%s' not found in kubeconfig", name)
+		}
+		exported.Contexts[name] = context
+
+		if cluster, exists := config.Clusters[context.Cluster]; exists {
+			exported.Clusters[context.Cluster] = cluster
+		} else if context.Cluster != "" {
+			return nil, fmt.Errorf("context '%s' references missing cluster '%s'", name, context.Cluster)
+		}
+
+		if authInfo, exists := config.AuthInfos[context.AuthInfo]; exists {
+			exported.AuthInfos[context.AuthInfo] = authInfo
+		} else if context.AuthInfo != "" {
+			return nil, fmt.Errorf("context '%s' references missing user '%s'", name, context.AuthInfo)
+		}
+	}
+
+	if _, exists := exported.Contexts[config.CurrentContext]; exists {
+		exported.CurrentContext = config.CurrentContext
+	} else if len(names) > 0 {
+		exported.CurrentContext = names[0]
+	}
+
+	return exported, nil
+}
+
+// minifyConfig drops everything from config that is not needed to connect:
+// preferences and the extensions of the config and of each entry
+func minifyConfig(config *clientcmdapi.Config) {
+	config.Preferences = *clientcmdapi.NewPreferences()
+	config.Extensions = nil
+
+	for _, context := range config.Contexts {
+		context.Extensions = nil
+	}
+	for _, cluster := range config.Clusters {
+		cluster.Extensions = nil
+	}
+	for _, authInfo := range config.AuthInfos {
+		authInfo.Extensions = nil
+	}
+}
@@ -0,0 +1,107 @@
+package kctx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// maxHistoryEntries caps how many previous entries each history list keeps
+const maxHistoryEntries = 20
+
+// history records previously used contexts and, per context, previously
+// used namespaces, oldest first
+type history struct {
+	Contexts   []string            `json:"contexts,omitempty"`
+	Namespaces map[string][]string `json:"namespaces,omitempty"`
+}
+
+func historyPath() string {
+	if path := os.Getenv("KCTX_HISTORY"); path != "" {
+		return path
+	}
+	return filepath.Join(clientcmd.RecommendedConfigDir, "kctx_history.json")
+}
+
+func loadHistory() (*history, error) {
+	h := &history{}
+
+	data, err := os.ReadFile(historyPath())
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading history file: %v", err)
+	}
+
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("error parsing history file: %v", err)
+	}
+	return h, nil
+}
+
+func (h *history) save() error {
+	path := historyPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error creating history directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding history: %v", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("error writing history file: %v", err)
+	}
+	return nil
+}
+
+// pushContext appends name as the most recent previous context
+func (h *history) pushContext(name string) {
+	h.Contexts = pushEntry(h.Contexts, name)
+}
+
+// previousContext returns the most recent entry that differs from current
+// and is accepted by exists
+func (h *history) previousContext(current string, exists func(string) bool) (string, bool) {
+	return previousEntry(h.Contexts, current, exists)
+}
+
+// pushNamespace appends namespace as the most recent previous namespace of
+// contextName
+func (h *history) pushNamespace(contextName, namespace string) {
+	if h.Namespaces == nil {
+		h.Namespaces = make(map[string][]string)
+	}
+	h.Namespaces[contextName] = pushEntry(h.Namespaces[contextName], namespace)
+}
+
+// previousNamespace returns the most recent namespace of contextName that
+// differs from current
+func (h *history) previousNamespace(contextName, current string) (string, bool) {
+	return previousEntry(h.Namespaces[contextName], current, func(string) bool { return true })
+}
+
+func pushEntry(entries []string, name string) []string {
+	if len(entries) > 0 && entries[len(entries)-1] == name {
+		return entries
+	}
+	entries = append(entries, name)
+	if len(entries) > maxHistoryEntries {
+		entries = entries[len(entries)-maxHistoryEntries:]
+	}
+	return entries
+}
+
+func previousEntry(entries []string, current string, exists func(string) bool) (string, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i] != current && exists(entries[i]) {
+			return entries[i], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,379 @@
+package kctx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ConflictStrategy decides what happens to an imported entry whose name is
+// already used in the kubeconfig
+type ConflictStrategy string
+
+const (
+	ConflictSkip      ConflictStrategy = "skip"
+	ConflictOverwrite ConflictStrategy = "overwrite"
+	ConflictRename    ConflictStrategy = "rename"
+)
+
+// ImportOptions configures ImportKubeconfigs
+type ImportOptions struct {
+	Conflict    ConflictStrategy
+	Prefix      string // Prepended to colliding names with ConflictRename
+	RenameRegex string // Applied to colliding names with ConflictRename
+	Replacement string // Replacement value for RenameRegex
+	Force       bool
+}
+
+// importAction records what happens to one imported entry
+type importAction struct {
+	Name    string
+	NewName string
+	Result  string // "add", "overwrite", "rename", "skip" or "unchanged"
+	Reason  string // Why a context was skipped although its name is free
+	Origin  string // File an overwritten entry is written back to
+}
+
+// importPlan holds the actions for each kind of imported entry
+type importPlan struct {
+	Contexts []importAction
+	Clusters []importAction
+	Users    []importAction
+}
+
+// ImportKubeconfigs merges the contexts, clusters and users of the given
+// kubeconfig files into the kubeconfig. A path of "-" reads from stdin.
+// Name collisions are resolved according to opts.Conflict, and every file
+// written to, the default kubeconfig file and the files of overwritten
+// entries, is backed up before anything is written.
+func ImportKubeconfigs(paths []string, opts ImportOptions) error {
+	if !opts.Force && slices.Contains(paths, "-") {
+		return fmt.Errorf("importing from stdin requires --force since the confirmation prompt also reads stdin")
+	}
+
+	renamer, err := newImportRenamer(opts)
+	if err != nil {
+		return err
+	}
+
+	loadingRules, rawConfig, err := loadKubeconfig()
+	if err != nil {
+		return err
+	}
+
+	var plan importPlan
+	for _, path := range paths {
+		imported, err := loadImportFile(path)
+		if err != nil {
+			return err
+		}
+		if err := mergeImported(rawConfig, imported, opts.Conflict, renamer, &plan); err != nil {
+			return fmt.Errorf("error importing %s: %v", importSourceName(path), err)
+		}
+	}
+
+	printImportPlan(plan)
+
+	counts := map[string]int{
+		"context": countChanged(plan.Contexts),
+		"cluster": countChanged(plan.Clusters),
+		"user":    countChanged(plan.Users),
+	}
+	if counts["context"]+counts["cluster"]+counts["user"] == 0 {
+		fmt.Println("Nothing to import")
+		return nil
+	}
+
+	if !opts.Force && !confirmChanges(fmt.Sprintf("Import %s?", describeCounts(counts))) {
+		fmt.Println("Operation cancelled.")
+		return nil
+	}
+
+	if err := backupFiles(plan.writtenFiles(loadingRules.GetDefaultFilename())); err != nil {
+		return err
+	}
+
+	if err := saveKubeconfig(loadingRules, rawConfig); err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully imported %s\n", describeCounts(counts))
+	return nil
+}
+
+// newImportRenamer returns the function that renames colliding entries, or
+// nil when the strategy does not rename
+func newImportRenamer(opts ImportOptions) (func(string) string, error) {
+	switch opts.Conflict {
+	case ConflictSkip, ConflictOverwrite:
+		return nil, nil
+	case ConflictRename:
+	default:
+		return nil, fmt.Errorf("unknown conflict strategy '%s' (want skip, overwrite or rename)", opts.Conflict)
+	}
+
+	if opts.RenameRegex != "" {
+		re, err := regexp.Compile(opts.RenameRegex)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling regex '%s': %v", opts.RenameRegex, err)
+		}
+		return func(name string) string {
+			return opts.Prefix + re.ReplaceAllString(name, opts.Replacement)
+		}, nil
+	}
+
+	if opts.Prefix == "" {
+		return nil, fmt.Errorf("rename strategy requires --prefix or --rename")
+	}
+	return func(name string) string {
+		return opts.Prefix + name
+	}, nil
+}
+
+func importSourceName(path string) string {
+	if path == "-" {
+		return "stdin"
+	}
+	return path
+}
+
+// loadImportFile reads a kubeconfig to import. Relative certificate and key
+// paths are made absolute against the file's directory (or the working
+// directory for stdin) so they keep working from the merged kubeconfig.
+func loadImportFile(path string) (*clientcmdapi.Config, error) {
+	if path != "-" {
+		config, err := clientcmd.LoadFromFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading %s: %v", path, err)
+		}
+		if err := clientcmd.ResolveLocalPaths(config); err != nil {
+			return nil, fmt.Errorf("error resolving paths in %s: %v", path, err)
+		}
+		return config, nil
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("error reading stdin: %v", err)
+	}
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("error loading stdin: %v", err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error determining working directory: %v", err)
+	}
+	for _, cluster := range config.Clusters {
+		if err := clientcmd.ResolvePaths(clientcmd.GetClusterFileReferences(cluster), cwd); err != nil {
+			return nil, err
+		}
+	}
+	for _, authInfo := range config.AuthInfos {
+		if err := clientcmd.ResolvePaths(clientcmd.GetAuthInfoFileReferences(authInfo), cwd); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// mergeImported adds the entries of imported to config. Clusters and users
+// are merged first so that contexts can be pointed at renamed ones. Contexts
+// referencing a skipped cluster or user are skipped too, as they would use
+// the unrelated existing entry of that name.
+func mergeImported(config, imported *clientcmdapi.Config, conflict ConflictStrategy, renamer func(string) string, plan *importPlan) error {
+	clusterNames, clusterActions, err := mergeEntries("cluster", config.Clusters, imported.Clusters, conflict, renamer, clusterOrigin)
+	if err != nil {
+		return err
+	}
+	userNames, userActions, err := mergeEntries("user", config.AuthInfos, imported.AuthInfos, conflict, renamer, authInfoOrigin)
+	if err != nil {
+		return err
+	}
+
+	var contextActions []importAction
+	for _, name := range sortedKeys(imported.Contexts) {
+		context := imported.Contexts[name]
+		var reason string
+		if skipped(clusterActions, context.Cluster) {
+			reason = fmt.Sprintf("cluster '%s' was skipped", context.Cluster)
+		} else if skipped(userActions, context.AuthInfo) {
+			reason = fmt.Sprintf("user '%s' was skipped", context.AuthInfo)
+		} else {
+			continue
+		}
+		delete(imported.Contexts, name)
+		contextActions = append(contextActions, importAction{Name: name, Result: "skip", Reason: reason})
+	}
+
+	for _, context := range imported.Contexts {
+		if newName, ok := clusterNames[context.Cluster]; ok {
+			context.Cluster = newName
+		}
+		if newName, ok := userNames[context.AuthInfo]; ok {
+			context.AuthInfo = newName
+		}
+	}
+
+	_, mergedContexts, err := mergeEntries("context", config.Contexts, imported.Contexts, conflict, renamer, contextOrigin)
+	if err != nil {
+		return err
+	}
+	contextActions = append(contextActions, mergedContexts...)
+	sort.Slice(contextActions, func(i, j int) bool {
+		return contextActions[i].Name < contextActions[j].Name
+	})
+
+	plan.Clusters = append(plan.Clusters, clusterActions...)
+	plan.Users = append(plan.Users, userActions...)
+	plan.Contexts = append(plan.Contexts, contextActions...)
+	return nil
+}
+
+// writtenFiles returns the files saving the plan changes: the default file,
+// which receives new entries, and the files of overwritten entries
+func (p importPlan) writtenFiles(defaultFile string) []string {
+	files := []string{defaultFile}
+	for _, actions := range [][]importAction{p.Contexts, p.Clusters, p.Users} {
+		for _, action := range actions {
+			if action.Result == "overwrite" && action.Origin != "" {
+				files = append(files, action.Origin)
+			}
+		}
+	}
+	return files
+}
+
+// skipped reports whether the entry called name was skipped because of a
+// name conflict
+func skipped(actions []importAction, name string) bool {
+	for _, action := range actions {
+		if action.Name == name {
+			return action.Result == "skip"
+		}
+	}
+	return false
+}
+
+func clusterOrigin(c *clientcmdapi.Cluster) *string   { return &c.LocationOfOrigin }
+func authInfoOrigin(a *clientcmdapi.AuthInfo) *string { return &a.LocationOfOrigin }
+func contextOrigin(c *clientcmdapi.Context) *string   { return &c.LocationOfOrigin }
+
+// mergeEntries merges imported into existing and returns the renames it
+// made along with one action per imported entry. New entries get an empty
+// origin so they are written to the default kubeconfig file; overwritten
+// entries keep the origin of the entry they replace.
+func mergeEntries[T any](kind string, existing, imported map[string]*T, conflict ConflictStrategy, renamer func(string) string, origin func(*T) *string) (map[string]string, []importAction, error) {
+	renames := make(map[string]string)
+	var actions []importAction
+
+	for _, name := range sortedKeys(imported) {
+		entry := imported[name]
+		current, exists := existing[name]
+		if !exists {
+			*origin(entry) = ""
+			existing[name] = entry
+			actions = append(actions, importAction{Name: name, Result: "add"})
+			continue
+		}
+
+		*origin(entry) = *origin(current)
+		if reflect.DeepEqual(entry, withResolvedPaths(current)) {
+			actions = append(actions, importAction{Name: name, Result: "unchanged"})
+			continue
+		}
+
+		switch conflict {
+		case ConflictSkip:
+			actions = append(actions, importAction{Name: name, Result: "skip"})
+		case ConflictOverwrite:
+			existing[name] = entry
+			actions = append(actions, importAction{Name: name, Result: "overwrite", Origin: *origin(current)})
+		case ConflictRename:
+			newName := renamer(name)
+			if newName == name {
+				return nil, nil, fmt.Errorf("renaming %s '%s' does not change its name", kind, name)
+			}
+			if _, taken := existing[newName]; taken {
+				return nil, nil, fmt.Errorf("cannot rename %s '%s': %s '%s' already exists", kind, name, kind, newName)
+			}
+			*origin(entry) = ""
+			existing[newName] = entry
+			renames[name] = newName
+			actions = append(actions, importAction{Name: name, NewName: newName, Result: "rename"})
+		}
+	}
+
+	return renames, actions, nil
+}
+
+// withResolvedPaths returns a copy of an existing cluster or user with its
+// relative file references made absolute against the directory of its
+// origin file, so it compares equal to the same entry imported by
+// loadImportFile. Other entries are returned as they are.
+func withResolvedPaths[T any](entry *T) *T {
+	var refs []*string
+	var origin string
+	switch e := any(entry).(type) {
+	case *clientcmdapi.Cluster:
+		e = e.DeepCopy()
+		entry, refs, origin = any(e).(*T), clientcmd.GetClusterFileReferences(e), e.LocationOfOrigin
+	case *clientcmdapi.AuthInfo:
+		e = e.DeepCopy()
+		entry, refs, origin = any(e).(*T), clientcmd.GetAuthInfoFileReferences(e), e.LocationOfOrigin
+	}
+	if origin != "" {
+		_ = clientcmd.ResolvePaths(refs, filepath.Dir(origin))
+	}
+	return entry
+}
+
+func countChanged(actions []importAction) int {
+	count := 0
+	for _, action := range actions {
+		if action.Result != "skip" && action.Result != "unchanged" {
+			count++
+		}
+	}
+	return count
+}
+
+func printImportPlan(plan importPlan) {
+	printImportActions("Contexts", plan.Contexts)
+	printImportActions("Clusters", plan.Clusters)
+	printImportActions("Users", plan.Users)
+}
+
+func printImportActions(title string, actions []importAction) {
+	if len(actions) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	for _, action := range actions {
+		switch action.Result {
+		case "add":
+			fmt.Printf("  + %s\n", action.Name)
+		case "overwrite":
+			fmt.Printf("  ~ %s (overwrite existing)\n", action.Name)
+		case "rename":
+			fmt.Printf("  + %s -> %s (name in use)\n", action.Name, action.NewName)
+		case "skip":
+			if action.Reason != "" {
+				fmt.Printf("  = %s (skipped, %s; use --conflict rename or overwrite)\n", action.Name, action.Reason)
+			} else {
+				fmt.Printf("  = %s (skipped, name in use)\n", action.Name)
+			}
+		case "unchanged":
+			fmt.Printf("  = %s (already present)\n", action.Name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package kctx
+
+import (
+	"reflect"
+	"testing"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// kubeadmConfig returns a kubeconfig shaped like the ones kubeadm writes,
+// with a cluster "kubernetes" and a user "kubernetes-admin" on server
+func kubeadmConfig(context, server, origin string) *clientcmdapi.Config {
+	config := clientcmdapi.NewConfig()
+	config.Clusters["kubernetes"] = &clientcmdapi.Cluster{Server: server, LocationOfOrigin: origin}
+	config.AuthInfos["kubernetes-admin"] = &clientcmdapi.AuthInfo{Token: "token", LocationOfOrigin: origin}
+	config.Contexts[context] = &clientcmdapi.Context{Cluster: "kubernetes", AuthInfo: "kubernetes-admin", LocationOfOrigin: origin}
+	return config
+}
+
+func TestMergeImported(t *testing.T) {
+	tests := []struct {
+		name     string
+		conflict ConflictStrategy
+		imported *clientcmdapi.Config
+		want     importPlan
+		// Cluster and user of the imported context after the merge, if kept
+		wantRefs []string
+	}{
+		{
+			name:     "skipped cluster skips its context",
+			conflict: ConflictSkip,
+			imported: kubeadmConfig("new", "https://new", "import"),
+			want: importPlan{
+				Contexts: []importAction{{Name: "new", Result: "skip", Reason: "cluster 'kubernetes' was skipped"}},
+				Clusters: []importAction{{Name: "kubernetes", Result: "skip"}},
+				Users:    []importAction{{Name: "kubernetes-admin", Result: "unchanged"}},
+			},
+		},
+		{
+			name:     "renamed cluster is referenced by its context",
+			conflict: ConflictRename,
+			imported: kubeadmConfig("new", "https://new", "import"),
+			want: importPlan{
+				Contexts: []importAction{{Name: "new", Result: "add"}},
+				Clusters: []importAction{{Name: "kubernetes", NewName: "new-kubernetes", Result: "rename"}},
+				Users:    []importAction{{Name: "kubernetes-admin", Result: "unchanged"}},
+			},
+			wantRefs: []string{"new-kubernetes", "kubernetes-admin"},
+		},
+		{
+			name:     "overwritten cluster keeps its origin",
+			conflict: ConflictOverwrite,
+			imported: kubeadmConfig("new", "https://new", "import"),
+			want: importPlan{
+				Contexts: []importAction{{Name: "new", Result: "add"}},
+				Clusters: []importAction{{Name: "kubernetes", Result: "overwrite", Origin: "existing"}},
+				Users:    []importAction{{Name: "kubernetes-admin", Result: "unchanged"}},
+			},
+			wantRefs: []string{"kubernetes", "kubernetes-admin"},
+		},
+		{
+			name:     "identical entries are unchanged",
+			conflict: ConflictSkip,
+			imported: kubeadmConfig("old", "https://old", "import"),
+			want: importPlan{
+				Contexts: []importAction{{Name: "old", Result: "unchanged"}},
+				Clusters: []importAction{{Name: "kubernetes", Result: "unchanged"}},
+				Users:    []importAction{{Name: "kubernetes-admin", Result: "unchanged"}},
+			},
+			wantRefs: []string{"kubernetes", "kubernetes-admin"},
+		},
+	}
+
+	renamer := func(name string) string { return "new-" + name }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := kubeadmConfig("old", "https://old", "existing")
+
+			var plan importPlan
+			if err := mergeImported(config, tt.imported, tt.conflict, renamer, &plan); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(plan, tt.want) {
+				t.Errorf("got plan %+v, want %+v", plan, tt.want)
+			}
+
+			name := tt.want.Contexts[0].Name
+			context, kept := config.Contexts[name]
+			if tt.wantRefs == nil {
+				if kept {
+					t.Errorf("context '%s' was merged although it was skipped", name)
+				}
+				return
+			}
+			if !kept {
+				t.Fatalf("context '%s' is missing", name)
+			}
+			if refs := []string{context.Cluster, context.AuthInfo}; !reflect.DeepEqual(refs, tt.wantRefs) {
+				t.Errorf("context references %v, want %v", refs, tt.wantRefs)
+			}
+		})
+	}
+}
+
+func TestWithResolvedPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *clientcmdapi.Cluster
+		imported *clientcmdapi.Cluster
+		equal    bool
+	}{
+		{
+			name:     "relative path next to origin",
+			existing: &clientcmdapi.Cluster{Server: "https://a", CertificateAuthority: "ca.crt", LocationOfOrigin: "/kube/config"},
+			imported: &clientcmdapi.Cluster{Server: "https://a", CertificateAuthority: "/kube/ca.crt", LocationOfOrigin: "/kube/config"},
+			equal:    true,
+		},
+		{
+			name:     "relative path elsewhere",
+			existing: &clientcmdapi.Cluster{Server: "https://a", CertificateAuthority: "ca.crt", LocationOfOrigin: "/kube/config"},
+			imported: &clientcmdapi.Cluster{Server: "https://a", CertificateAuthority: "/other/ca.crt", LocationOfOrigin: "/kube/config"},
+		},
+		{
+			name:     "absolute path",
+			existing: &clientcmdapi.Cluster{Server: "https://a", CertificateAuthority: "/kube/ca.crt", LocationOfOrigin: "/kube/config"},
+			imported: &clientcmdapi.Cluster{Server: "https://a", CertificateAuthority: "/kube/ca.crt", LocationOfOrigin: "/kube/config"},
+			equal:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved := withResolvedPaths(tt.existing)
+			if equal := reflect.DeepEqual(resolved, tt.imported); equal != tt.equal {
+				t.Errorf("got equal %v, want %v (resolved %+v)", equal, tt.equal, resolved)
+			}
+			if tt.existing.CertificateAuthority == "ca.crt" && resolved == tt.existing {
+				t.Errorf("existing entry was modified instead of copied")
+			}
+		})
+	}
+}
+
+func TestWrittenFiles(t *testing.T) {
+	plan := importPlan{
+		Contexts: []importAction{{Name: "a", Result: "add"}, {Name: "b", Result: "overwrite", Origin: "/kube/b"}},
+		Clusters: []importAction{{Name: "c", Result: "skip"}},
+		Users:    []importAction{{Name: "d", Result: "overwrite", Origin: "/kube/d"}},
+	}
+	want := []string{"/kube/config", "/kube/b", "/kube/d"}
+	if got := plan.writtenFiles("/kube/config"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,37 @@
+package kctx
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// loadKubeconfig loads the merged kubeconfig for commands that modify it.
+// Relative paths are left unresolved and every context, cluster and user
+// keeps the LocationOfOrigin of the file it was read from, so changes can be
+// written back with saveKubeconfig.
+func loadKubeconfig() (*clientcmd.ClientConfigLoadingRules, *clientcmdapi.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.DoNotResolvePaths = true
+	configOverrides := &clientcmd.ConfigOverrides{}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+
+	return loadingRules, &rawConfig, nil
+}
+
+// saveKubeconfig writes the differences between config and the kubeconfig on
+// disk. Each changed or removed context, cluster and user is written to the
+// file it was loaded from; new entries without an origin go to the default
+// file. Other files in a multi-file KUBECONFIG are left untouched.
+func saveKubeconfig(loadingRules *clientcmd.ClientConfigLoadingRules, config *clientcmdapi.Config) error {
+	if err := clientcmd.ModifyConfig(loadingRules, *config, false); err != nil {
+		return fmt.Errorf("error writing kubeconfig: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package kctx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// defaultNamespace is what kubectl uses when a context sets no namespace
+const defaultNamespace = "default"
+
+// validateTimeout bounds the namespace lookup against the live cluster
+const validateTimeout = 10 * time.Second
+
+// ShowNamespace prints the default namespace of contextName, or of the
+// current context when contextName is empty.
+func ShowNamespace(contextName string) error {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	configOverrides := &clientcmd.ConfigOverrides{}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+
+	contextName, err = resolveContextName(rawConfig.CurrentContext, contextName)
+	if err != nil {
+		return err
+	}
+
+	kubeContext, exists := rawConfig.Contexts[contextName]
+	if !exists {
+		return fmt.Errorf("context '%s' not found in kubeconfig", contextName)
+	}
+
+	namespace := kubeContext.Namespace
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	fmt.Println(namespace)
+	return nil
+}
+
+// UseNamespace sets the default namespace of contextName, or of the current
+// context when contextName is empty. A namespace of "-" switches back to the
+// previously used namespace of that context. When validate is set the
+// namespace must exist in the context's cluster.
+func UseNamespace(contextName, namespace string, validate bool) error {
+	loadingRules, rawConfig, err := loadKubeconfig()
+	if err != nil {
+		return err
+	}
+
+	contextName, err = resolveContextName(rawConfig.CurrentContext, contextName)
+	if err != nil {
+		return err
+	}
+
+	kubeContext, exists := rawConfig.Contexts[contextName]
+	if !exists {
+		return fmt.Errorf("context '%s' not found in kubeconfig", contextName)
+	}
+
+	current := kubeContext.Namespace
+	if current == "" {
+		current = defaultNamespace
+	}
+
+	h, err := loadHistory()
+	if err != nil {
+		return err
+	}
+
+	if namespace == "-" {
+		previous, ok := h.previousNamespace(contextName, current)
+		if !ok {
+			return fmt.Errorf("no previous namespace in history for context '%s'", contextName)
+		}
+		namespace = previous
+	}
+
+	if namespace == current {
+		fmt.Printf("Already using namespace %s in context %s\n", namespace, contextName)
+		return nil
+	}
+
+	if validate {
+		if err := validateNamespace(contextName, namespace); err != nil {
+			return err
+		}
+	}
+
+	kubeContext.Namespace = namespace
+	if err := saveKubeconfig(loadingRules, rawConfig); err != nil {
+		return err
+	}
+
+	h.pushNamespace(contextName, current)
+	if err := h.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Switched to namespace %s in context %s\n", namespace, contextName)
+	return nil
+}
+
+func resolveContextName(currentContext, contextName string) (string, error) {
+	if contextName != "" {
+		return contextName, nil
+	}
+	if currentContext == "" {
+		return "", fmt.Errorf("no current context set; use --context to choose one")
+	}
+	return currentContext, nil
+}
+
+// validateNamespace checks that namespace exists in the cluster of
+// contextName. It only warns when RBAC forbids reading the namespace.
+func validateNamespace(contextName, namespace string) error {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: contextName}
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+
+	restConfig, err := kubeConfig.ClientConfig()
+	if err != nil {
+		return fmt.Errorf("error loading client config for context '%s': %v", contextName, err)
+	}
+	restConfig.Timeout = validateTimeout
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("error creating clientset: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+
+	_, err = clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		return nil
+	case apierrors.IsNotFound(err):
+		return fmt.Errorf("namespace '%s' not found in cluster of context '%s'", namespace, contextName)
+	case apierrors.IsForbidden(err):
+		// Users may work in a namespace without being allowed to read it
+		fmt.Fprintf(os.Stderr, "Warning: not allowed to check namespace '%s' in context '%s', switching anyway\n", namespace, contextName)
+		return nil
+	default:
+		return fmt.Errorf("error checking namespace: %v", err)
+	}
+}
@@ -0,0 +1,356 @@
+package kctx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Styles
+var (
+	pickPromptStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("12"))
+
+	pickCursorStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("0")).
+			Background(lipgloss.Color("12"))
+
+	pickCurrentStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("10")) // Green
+
+	pickMatchStyle = lipgloss.NewStyle().
+			Underline(true)
+
+	pickPanelStyle = lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("8")).
+			Padding(0, 1)
+
+	pickLabelStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("8"))
+
+	pickHelpStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("8"))
+)
+
+// pickEntry describes a context shown in the picker
+type pickEntry struct {
+	Name      string
+	Cluster   string
+	Server    string
+	User      string
+	Namespace string
+	Current   bool
+}
+
+// pickMatch is an entry that passed the filter along with its score and
+// the rune positions that matched
+type pickMatch struct {
+	entry     pickEntry
+	score     int
+	positions []int
+}
+
+type pickModel struct {
+	entries  []pickEntry
+	filter   string
+	matches  []pickMatch
+	cursor   int
+	offset   int
+	height   int
+	selected string
+	quitting bool
+}
+
+// PickContext shows an interactive fuzzy finder over all contexts and
+// switches to the one chosen with Enter.
+func PickContext() error {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	configOverrides := &clientcmd.ConfigOverrides{}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+
+	contexts, err := getContexts()
+	if err != nil {
+		return err
+	}
+
+	if len(contexts) == 0 {
+		fmt.Println("No contexts found in kubeconfig")
+		return nil
+	}
+
+	sort.Strings(contexts)
+	entries := make([]pickEntry, 0, len(contexts))
+	for _, contextName := range contexts {
+		context := rawConfig.Contexts[contextName]
+		entry := pickEntry{
+			Name:      contextName,
+			Cluster:   context.Cluster,
+			User:      context.AuthInfo,
+			Namespace: context.Namespace,
+			Current:   contextName == rawConfig.CurrentContext,
+		}
+		if cluster, ok := rawConfig.Clusters[context.Cluster]; ok {
+			entry.Server = cluster.Server
+		}
+		entries = append(entries, entry)
+	}
+
+	result, err := tea.NewProgram(newPickModel(entries), tea.WithAltScreen()).Run()
+	if err != nil {
+		return fmt.Errorf("error running picker: %v", err)
+	}
+
+	selected := result.(pickModel).selected
+	if selected == "" {
+		return nil
+	}
+	return UseContext(selected)
+}
+
+func newPickModel(entries []pickEntry) pickModel {
+	m := pickModel{
+		entries: entries,
+		height:  20,
+	}
+	m.applyFilter()
+
+	// Start with the cursor on the current context
+	for i, match := range m.matches {
+		if match.entry.Current {
+			m.cursor = i
+			break
+		}
+	}
+	m.scroll()
+	return m
+}
+
+func (m pickModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m pickModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			m.quitting = true
+			return m, tea.Quit
+		case tea.KeyEnter:
+			if len(m.matches) > 0 {
+				m.selected = m.matches[m.cursor].entry.Name
+			}
+			m.quitting = true
+			return m, tea.Quit
+		case tea.KeyUp, tea.KeyCtrlP:
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case tea.KeyDown, tea.KeyCtrlN:
+			if m.cursor < len(m.matches)-1 {
+				m.cursor++
+			}
+		case tea.KeyBackspace:
+			if len(m.filter) > 0 {
+				runes := []rune(m.filter)
+				m.filter = string(runes[:len(runes)-1])
+				m.applyFilter()
+			}
+		case tea.KeyCtrlU:
+			m.filter = ""
+			m.applyFilter()
+		case tea.KeyRunes, tea.KeySpace:
+			m.filter += string(msg.Runes)
+			m.applyFilter()
+		}
+		m.scroll()
+
+	case tea.WindowSizeMsg:
+		// Leave room for the prompt, separator and help lines
+		m.height = max(msg.Height-4, 1)
+		m.scroll()
+	}
+
+	return m, nil
+}
+
+func (m pickModel) View() string {
+	if m.quitting {
+		return ""
+	}
+
+	var list strings.Builder
+	if len(m.matches) == 0 {
+		list.WriteString(pickLabelStyle.Render("  no matching contexts"))
+		list.WriteString("\n")
+	}
+
+	end := min(m.offset+m.height, len(m.matches))
+	for i := m.offset; i < end; i++ {
+		match := m.matches[i]
+		marker := "  "
+		if match.entry.Current {
+			marker = "* "
+		}
+
+		if i == m.cursor {
+			list.WriteString(pickCursorStyle.Render(marker + match.entry.Name))
+		} else {
+			name := highlightMatches(match.entry.Name, match.positions)
+			if match.entry.Current {
+				list.WriteString(pickCurrentStyle.Render(marker) + pickCurrentStyle.Render(name))
+			} else {
+				list.WriteString(marker + name)
+			}
+		}
+		list.WriteString("\n")
+	}
+
+	var b strings.Builder
+	b.WriteString(pickPromptStyle.Render("> "))
+	b.WriteString(m.filter)
+	b.WriteString("\n")
+	b.WriteString(pickHelpStyle.Render(fmt.Sprintf("  %d/%d", len(m.matches), len(m.entries))))
+	b.WriteString("\n")
+
+	if len(m.matches) > 0 {
+		panel := renderPickPanel(m.matches[m.cursor].entry)
+		b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, list.String(), "  ", panel))
+	} else {
+		b.WriteString(list.String())
+	}
+
+	b.WriteString("\n")
+	b.WriteString(pickHelpStyle.Render("type to filter • ↑/↓ move • enter switch • esc quit"))
+	b.WriteString("\n")
+	return b.String()
+}
+
+func renderPickPanel(entry pickEntry) string {
+	namespace := entry.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	lines := []string{
+		pickPromptStyle.Render(entry.Name),
+		"",
+		pickLabelStyle.Render("Cluster:   ") + orNone(entry.Cluster),
+		pickLabelStyle.Render("Server:    ") + orNone(entry.Server),
+		pickLabelStyle.Render("User:      ") + orNone(entry.User),
+		pickLabelStyle.Render("Namespace: ") + namespace,
+	}
+	return pickPanelStyle.Render(strings.Join(lines, "\n"))
+}
+
+// applyFilter recomputes the matching entries for the current filter.
+// Entries keep their alphabetical order when the filter is empty and are
+// ranked by score otherwise.
+func (m *pickModel) applyFilter() {
+	var matches []pickMatch
+	for _, entry := range m.entries {
+		score, positions, ok := fuzzyMatch(m.filter, entry.Name)
+		if ok {
+			matches = append(matches, pickMatch{entry: entry, score: score, positions: positions})
+		}
+	}
+	m.matches = matches
+
+	if m.filter != "" {
+		sort.SliceStable(m.matches, func(i, j int) bool {
+			return m.matches[i].score > m.matches[j].score
+		})
+	}
+	m.cursor = 0
+	m.offset = 0
+}
+
+// scroll keeps the cursor inside the visible window
+func (m *pickModel) scroll() {
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+m.height {
+		m.offset = m.cursor - m.height + 1
+	}
+}
+
+// fuzzyMatch reports whether every rune of pattern appears in s in order,
+// ignoring case. The score favours consecutive runs and matches at the
+// start of words so that "prd" ranks "prod-eu" above "my-project-dev".
+func fuzzyMatch(pattern, s string) (int, []int, bool) {
+	if pattern == "" {
+		return 0, nil, true
+	}
+
+	patternRunes := []rune(strings.ToLower(pattern))
+	runes := []rune(s)
+	lower := []rune(strings.ToLower(s))
+
+	score := 0
+	positions := make([]int, 0, len(patternRunes))
+	p := 0
+	prev := -2
+	for i := 0; i < len(lower) && p < len(patternRunes); i++ {
+		if lower[i] != patternRunes[p] {
+			continue
+		}
+
+		score++
+		if i == prev+1 {
+			score += 5
+		} else if prev >= 0 {
+			// Penalise gaps between matched runes
+			score -= i - prev - 1
+		}
+		if i == 0 || !unicode.IsLetter(runes[i-1]) && !unicode.IsDigit(runes[i-1]) {
+			score += 3
+		}
+
+		positions = append(positions, i)
+		prev = i
+		p++
+	}
+
+	if p < len(patternRunes) {
+		return 0, nil, false
+	}
+
+	// Prefer shorter names when everything else is equal
+	score -= len(runes) / 10
+	return score, positions, true
+}
+
+func highlightMatches(s string, positions []int) string {
+	if len(positions) == 0 {
+		return s
+	}
+
+	matched := make(map[int]bool, len(positions))
+	for _, pos := range positions {
+		matched[pos] = true
+	}
+
+	var b strings.Builder
+	for i, r := range []rune(s) {
+		if matched[i] {
+			b.WriteString(pickMatchStyle.Render(string(r)))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
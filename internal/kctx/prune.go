@@ -0,0 +1,157 @@
+package kctx
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ErrPruneNeeded is returned by a dry run that found something to prune, so
+// callers can fail CI checks without treating it as a real error
+var ErrPruneNeeded = errors.New("kubeconfig has entries to prune")
+
+// BrokenContext is a context that references a missing cluster or user
+type BrokenContext struct {
+	Name     string
+	Problems []string
+}
+
+// PruneReport describes the dangling entries found in a kubeconfig
+type PruneReport struct {
+	BrokenContexts        []BrokenContext
+	OrphanedClusters      []string
+	OrphanedUsers         []string
+	MissingCurrentContext string
+}
+
+// Empty reports whether nothing needs pruning
+func (r PruneReport) Empty() bool {
+	return len(r.BrokenContexts) == 0 && len(r.OrphanedClusters) == 0 &&
+		len(r.OrphanedUsers) == 0 && r.MissingCurrentContext == ""
+}
+
+// Prune removes contexts that reference missing clusters or users, clusters
+// and users that no remaining context references, and a current-context
+// that names a missing context. With dryRun the findings are only reported
+// and ErrPruneNeeded is returned if there are any.
+func Prune(dryRun, force bool) error {
+	loadingRules, rawConfig, err := loadKubeconfig()
+	if err != nil {
+		return err
+	}
+
+	report := analyzeKubeconfig(rawConfig)
+	if report.Empty() {
+		fmt.Println("Nothing to prune")
+		return nil
+	}
+
+	printPruneReport(report)
+
+	plan := DeletionPlan{
+		Clusters: report.OrphanedClusters,
+		Users:    report.OrphanedUsers,
+	}
+	for _, broken := range report.BrokenContexts {
+		plan.Contexts = append(plan.Contexts, broken.Name)
+	}
+
+	if dryRun {
+		fmt.Println("Dry run: no changes made.")
+		return ErrPruneNeeded
+	}
+
+	question := fmt.Sprintf("Delete %s?", plan.describe())
+	if plan.Len() == 0 {
+		question = "Unset current-context?"
+	}
+	if !force && !confirmChanges(question) {
+		fmt.Println("Operation cancelled.")
+		return nil
+	}
+
+	if report.MissingCurrentContext != "" {
+		rawConfig.CurrentContext = ""
+		if plan.Len() == 0 {
+			if err := saveKubeconfig(loadingRules, rawConfig); err != nil {
+				return err
+			}
+			fmt.Println("Successfully unset current-context")
+			return nil
+		}
+	}
+	return applyDeletionPlan(loadingRules, rawConfig, plan)
+}
+
+// analyzeKubeconfig walks the context -> cluster/user references of config.
+// Clusters and users only referenced by broken contexts count as orphaned,
+// since they will be unreferenced once those contexts are removed.
+func analyzeKubeconfig(config *clientcmdapi.Config) PruneReport {
+	var report PruneReport
+
+	referencedClusters := make(map[string]bool)
+	referencedUsers := make(map[string]bool)
+	for _, name := range sortedKeys(config.Contexts) {
+		context := config.Contexts[name]
+
+		var problems []string
+		if context.Cluster == "" {
+			problems = append(problems, "no cluster set")
+		} else if _, exists := config.Clusters[context.Cluster]; !exists {
+			problems = append(problems, fmt.Sprintf("missing cluster '%s'", context.Cluster))
+		}
+		if context.AuthInfo != "" {
+			if _, exists := config.AuthInfos[context.AuthInfo]; !exists {
+				problems = append(problems, fmt.Sprintf("missing user '%s'", context.AuthInfo))
+			}
+		}
+
+		if len(problems) > 0 {
+			report.BrokenContexts = append(report.BrokenContexts, BrokenContext{Name: name, Problems: problems})
+			continue
+		}
+		referencedClusters[context.Cluster] = true
+		if context.AuthInfo != "" {
+			referencedUsers[context.AuthInfo] = true
+		}
+	}
+
+	for name := range config.Clusters {
+		if !referencedClusters[name] {
+			report.OrphanedClusters = append(report.OrphanedClusters, name)
+		}
+	}
+	for name := range config.AuthInfos {
+		if !referencedUsers[name] {
+			report.OrphanedUsers = append(report.OrphanedUsers, name)
+		}
+	}
+	sort.Strings(report.OrphanedClusters)
+	sort.Strings(report.OrphanedUsers)
+
+	if config.CurrentContext != "" {
+		if _, exists := config.Contexts[config.CurrentContext]; !exists {
+			report.MissingCurrentContext = config.CurrentContext
+		}
+	}
+
+	return report
+}
+
+func printPruneReport(report PruneReport) {
+	if len(report.BrokenContexts) > 0 {
+		fmt.Println("Broken contexts:")
+		for _, broken := range report.BrokenContexts {
+			fmt.Printf("  - %s (%s)\n", broken.Name, strings.Join(broken.Problems, ", "))
+		}
+	}
+	printNames("Orphaned clusters", report.OrphanedClusters)
+	printNames("Orphaned users", report.OrphanedUsers)
+	if report.MissingCurrentContext != "" {
+		fmt.Println("Current context:")
+		fmt.Printf("  - %s (context does not exist)\n", report.MissingCurrentContext)
+	}
+}
@@ -0,0 +1,189 @@
+package kctx
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// DeletionPlan lists the kubeconfig entries to remove, by kind
+type DeletionPlan struct {
+	Contexts []string
+	Clusters []string
+	Users    []string
+}
+
+// Len returns the total number of entries in the plan
+func (p DeletionPlan) Len() int {
+	return len(p.Contexts) + len(p.Clusters) + len(p.Users)
+}
+
+// RemoveContexts deletes the named contexts. With prune, clusters and users
+// that were only referenced by the deleted contexts are removed too. The
+// current context is only deleted when current is set, and force skips the
+// confirmation prompt.
+func RemoveContexts(names []string, current, force, prune bool) error {
+	loadingRules, rawConfig, err := loadKubeconfig()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, exists := rawConfig.Contexts[name]; !exists {
+			return fmt.Errorf("context '%s' not found in kubeconfig", name)
+		}
+	}
+
+	return removeContexts(loadingRules, rawConfig, names, current, force, prune)
+}
+
+// RemoveContextsByRegex deletes every context whose name matches regex. See
+// RemoveContexts for the meaning of current, force and prune.
+func RemoveContextsByRegex(regex string, current, force, prune bool) error {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return fmt.Errorf("error compiling regex '%s': %v", regex, err)
+	}
+
+	loadingRules, rawConfig, err := loadKubeconfig()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for contextName := range rawConfig.Contexts {
+		if re.MatchString(contextName) {
+			names = append(names, contextName)
+		}
+	}
+
+	if len(names) == 0 {
+		fmt.Printf("No contexts matched regex: %s\n", regex)
+		return nil
+	}
+
+	return removeContexts(loadingRules, rawConfig, names, current, force, prune)
+}
+
+func removeContexts(loadingRules *clientcmd.ClientConfigLoadingRules, config *clientcmdapi.Config, names []string, current, force, prune bool) error {
+	plan := DeletionPlan{Contexts: uniqueSorted(names)}
+
+	for _, name := range plan.Contexts {
+		if name == config.CurrentContext && !current {
+			return fmt.Errorf("refusing to delete current context '%s' without --current", name)
+		}
+	}
+
+	if prune {
+		plan.Clusters, plan.Users = orphanedBy(config, plan.Contexts)
+	}
+
+	printDeletionPlan(plan)
+
+	if !force && !confirmChanges(fmt.Sprintf("Delete %s?", plan.describe())) {
+		fmt.Println("Operation cancelled.")
+		return nil
+	}
+
+	return applyDeletionPlan(loadingRules, config, plan)
+}
+
+// orphanedBy returns the clusters and users referenced by the removed
+// contexts that no remaining context references
+func orphanedBy(config *clientcmdapi.Config, removed []string) ([]string, []string) {
+	removedSet := make(map[string]bool, len(removed))
+	for _, name := range removed {
+		removedSet[name] = true
+	}
+
+	candidateClusters := make(map[string]bool)
+	candidateUsers := make(map[string]bool)
+	for _, name := range removed {
+		context := config.Contexts[name]
+		if _, exists := config.Clusters[context.Cluster]; exists {
+			candidateClusters[context.Cluster] = true
+		}
+		if _, exists := config.AuthInfos[context.AuthInfo]; exists {
+			candidateUsers[context.AuthInfo] = true
+		}
+	}
+
+	for name, context := range config.Contexts {
+		if removedSet[name] {
+			continue
+		}
+		delete(candidateClusters, context.Cluster)
+		delete(candidateUsers, context.AuthInfo)
+	}
+
+	return sortedKeys(candidateClusters), sortedKeys(candidateUsers)
+}
+
+func printDeletionPlan(plan DeletionPlan) {
+	printNames("Contexts", plan.Contexts)
+	printNames("Clusters", plan.Clusters)
+	printNames("Users", plan.Users)
+}
+
+func printNames(title string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	for _, name := range names {
+		fmt.Printf("  - %s\n", name)
+	}
+}
+
+func (p DeletionPlan) describe() string {
+	return describeCounts(map[string]int{
+		"context": len(p.Contexts),
+		"cluster": len(p.Clusters),
+		"user":    len(p.Users),
+	})
+}
+
+// applyDeletionPlan removes the planned entries from config, unsets
+// current-context if it was deleted, and writes each change back to the
+// kubeconfig file it was loaded from
+func applyDeletionPlan(loadingRules *clientcmd.ClientConfigLoadingRules, config *clientcmdapi.Config, plan DeletionPlan) error {
+	for _, name := range plan.Contexts {
+		delete(config.Contexts, name)
+		if config.CurrentContext == name {
+			config.CurrentContext = ""
+		}
+	}
+	for _, name := range plan.Clusters {
+		delete(config.Clusters, name)
+	}
+	for _, name := range plan.Users {
+		delete(config.AuthInfos, name)
+	}
+
+	if err := saveKubeconfig(loadingRules, config); err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully deleted %s\n", plan.describe())
+	return nil
+}
+
+func uniqueSorted(names []string) []string {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return sortedKeys(set)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -5,103 +5,186 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
-type ContextChange struct {
+// NameChange is the rename of a single kubeconfig entry
+type NameChange struct {
 	OldName string
 	NewName string
 }
 
-func ReplaceInContexts(inputRegex, replacement string, force bool) error {
+// Scope selects which kinds of kubeconfig entries are renamed
+type Scope struct {
+	Contexts bool
+	Clusters bool
+	Users    bool
+}
+
+// RenamePlan holds the renames for each kind of kubeconfig entry
+type RenamePlan struct {
+	Contexts []NameChange
+	Clusters []NameChange
+	Users    []NameChange
+}
+
+// Len returns the total number of renames in the plan
+func (p RenamePlan) Len() int {
+	return len(p.Contexts) + len(p.Clusters) + len(p.Users)
+}
+
+// ReplaceInContexts replaces matches of inputRegex with replacement in the
+// names of the entries selected by scope.
+func ReplaceInContexts(inputRegex, replacement string, scope Scope, force bool) error {
 	re, err := regexp.Compile(inputRegex)
 	if err != nil {
 		return fmt.Errorf("error compiling regex '%s': %v", inputRegex, err)
 	}
 
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	configOverrides := &clientcmd.ConfigOverrides{}
-	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+	return transformNames(re, replacement, scope, force)
+}
 
-	rawConfig, err := clientConfig.RawConfig()
+// DeleteFromContexts removes matches of deletionRegex from the names of the
+// entries selected by scope.
+func DeleteFromContexts(deletionRegex string, scope Scope, force bool) error {
+	re, err := regexp.Compile(deletionRegex)
 	if err != nil {
-		return fmt.Errorf("error loading kubeconfig: %v", err)
+		return fmt.Errorf("error compiling regex '%s': %v", deletionRegex, err)
 	}
 
-	var changes []ContextChange
-	for contextName := range rawConfig.Contexts {
-		if re.MatchString(contextName) {
-			newName := re.ReplaceAllString(contextName, replacement)
-			if newName != contextName {
-				changes = append(changes, ContextChange{OldName: contextName, NewName: newName})
-			}
-		}
+	return transformNames(re, "", scope, force)
+}
+
+func transformNames(re *regexp.Regexp, replacement string, scope Scope, force bool) error {
+	loadingRules, rawConfig, err := loadKubeconfig()
+	if err != nil {
+		return err
 	}
 
-	if len(changes) == 0 {
-		fmt.Printf("No contexts matched regex: %s\n", inputRegex)
+	plan := planRenames(rawConfig, re, replacement, scope)
+	if plan.Len() == 0 {
+		fmt.Printf("No names matched regex: %s\n", re.String())
 		return nil
 	}
 
-	for _, change := range changes {
-		fmt.Printf("%s -> %s\n", change.OldName, change.NewName)
+	if err := checkRenameCollisions(rawConfig, plan); err != nil {
+		return err
 	}
 
-	if !force && !confirmChanges(len(changes)) {
+	printRenamePlan(plan)
+
+	if !force && !confirmChanges(fmt.Sprintf("Apply %d change(s)?", plan.Len())) {
 		fmt.Println("Operation cancelled.")
 		return nil
 	}
 
-	return applyContextChanges(&rawConfig, changes, loadingRules.GetDefaultFilename())
+	return applyRenamePlan(loadingRules, rawConfig, plan)
 }
 
-func DeleteFromContexts(deletionRegex string, force bool) error {
-	re, err := regexp.Compile(deletionRegex)
-	if err != nil {
-		return fmt.Errorf("error compiling regex '%s': %v", deletionRegex, err)
+func planRenames(config *clientcmdapi.Config, re *regexp.Regexp, replacement string, scope Scope) RenamePlan {
+	var plan RenamePlan
+	if scope.Contexts {
+		plan.Contexts = renameKeys(config.Contexts, re, replacement)
 	}
-
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	configOverrides := &clientcmd.ConfigOverrides{}
-	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
-
-	rawConfig, err := clientConfig.RawConfig()
-	if err != nil {
-		return fmt.Errorf("error loading kubeconfig: %v", err)
+	if scope.Clusters {
+		plan.Clusters = renameKeys(config.Clusters, re, replacement)
+	}
+	if scope.Users {
+		plan.Users = renameKeys(config.AuthInfos, re, replacement)
 	}
+	return plan
+}
 
-	var changes []ContextChange
-	for contextName := range rawConfig.Contexts {
-		if re.MatchString(contextName) {
-			newName := re.ReplaceAllString(contextName, "")
-			if newName != contextName {
-				changes = append(changes, ContextChange{OldName: contextName, NewName: newName})
+// renameKeys applies the regex replacement to every key of entries and
+// returns the resulting renames sorted by old name
+func renameKeys[V any](entries map[string]V, re *regexp.Regexp, replacement string) []NameChange {
+	var changes []NameChange
+	for name := range entries {
+		if re.MatchString(name) {
+			newName := re.ReplaceAllString(name, replacement)
+			if newName != name {
+				changes = append(changes, NameChange{OldName: name, NewName: newName})
 			}
 		}
 	}
 
-	if len(changes) == 0 {
-		fmt.Printf("No contexts matched regex: %s\n", deletionRegex)
-		return nil
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].OldName < changes[j].OldName
+	})
+	return changes
+}
+
+// checkRenameCollisions rejects renames that would overwrite an existing
+// entry or merge two entries into one, and swaps or chains of renames
+// across kubeconfig files, which cannot be written back to their origins
+func checkRenameCollisions(config *clientcmdapi.Config, plan RenamePlan) error {
+	if err := checkKeyCollisions("context", config.Contexts, plan.Contexts, func(c *clientcmdapi.Context) string {
+		return c.LocationOfOrigin
+	}); err != nil {
+		return err
+	}
+	if err := checkKeyCollisions("cluster", config.Clusters, plan.Clusters, func(c *clientcmdapi.Cluster) string {
+		return c.LocationOfOrigin
+	}); err != nil {
+		return err
 	}
+	return checkKeyCollisions("user", config.AuthInfos, plan.Users, func(u *clientcmdapi.AuthInfo) string {
+		return u.LocationOfOrigin
+	})
+}
 
+func checkKeyCollisions[V any](kind string, entries map[string]V, changes []NameChange, origin func(V) string) error {
+	renamed := make(map[string]bool, len(changes))
 	for _, change := range changes {
-		fmt.Printf("%s -> %s\n", change.OldName, change.NewName)
+		renamed[change.OldName] = true
 	}
 
-	if !force && !confirmChanges(len(changes)) {
-		fmt.Println("Operation cancelled.")
-		return nil
+	targets := make(map[string]string, len(changes))
+	for _, change := range changes {
+		if other, seen := targets[change.NewName]; seen {
+			return fmt.Errorf("%ss '%s' and '%s' would both be renamed to '%s'", kind, other, change.OldName, change.NewName)
+		}
+		targets[change.NewName] = change.OldName
+
+		existing, exists := entries[change.NewName]
+		if !exists {
+			continue
+		}
+		if !renamed[change.NewName] {
+			return fmt.Errorf("cannot rename %s '%s': %s '%s' already exists", kind, change.OldName, kind, change.NewName)
+		}
+		// Each file keeps the keys that still exist in the merged config,
+		// so a name moving between files would end up in both
+		if from, to := origin(entries[change.OldName]), origin(existing); from != to {
+			return fmt.Errorf("cannot rename %s '%s' to '%s': '%s' is renamed too but defined in %s instead of %s",
+				kind, change.OldName, change.NewName, change.NewName, to, from)
+		}
 	}
+	return nil
+}
 
-	return applyContextChanges(&rawConfig, changes, loadingRules.GetDefaultFilename())
+func printRenamePlan(plan RenamePlan) {
+	printNameChanges("Contexts", plan.Contexts)
+	printNameChanges("Clusters", plan.Clusters)
+	printNameChanges("Users", plan.Users)
 }
 
-func confirmChanges(count int) bool {
-	fmt.Printf("Apply changes to %d context(s)? [y/N]: ", count)
+func printNameChanges(title string, changes []NameChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	for _, change := range changes {
+		fmt.Printf("  %s -> %s\n", change.OldName, change.NewName)
+	}
+}
+
+func confirmChanges(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
 	reader := bufio.NewReader(os.Stdin)
 	response, err := reader.ReadString('\n')
 	if err != nil {
@@ -111,22 +194,77 @@ func confirmChanges(count int) bool {
 	return response == "y" || response == "yes"
 }
 
-func applyContextChanges(config *clientcmdapi.Config, changes []ContextChange, configPath string) error {
-	for _, change := range changes {
-		if context, exists := config.Contexts[change.OldName]; exists {
-			config.Contexts[change.NewName] = context
-			delete(config.Contexts, change.OldName)
+// applyRenamePlan renames entries in config, rewrites every context that
+// references a renamed cluster or user, and writes each change back to the
+// kubeconfig file it was loaded from
+func applyRenamePlan(loadingRules *clientcmd.ClientConfigLoadingRules, config *clientcmdapi.Config, plan RenamePlan) error {
+	renameMapKeys(config.Contexts, plan.Contexts)
+	renameMapKeys(config.Clusters, plan.Clusters)
+	renameMapKeys(config.AuthInfos, plan.Users)
 
-			if config.CurrentContext == change.OldName {
-				config.CurrentContext = change.NewName
-			}
+	for _, change := range plan.Contexts {
+		if config.CurrentContext == change.OldName {
+			config.CurrentContext = change.NewName
+		}
+	}
+
+	clusterNames := changeMap(plan.Clusters)
+	userNames := changeMap(plan.Users)
+	for _, context := range config.Contexts {
+		if newName, ok := clusterNames[context.Cluster]; ok {
+			context.Cluster = newName
+		}
+		if newName, ok := userNames[context.AuthInfo]; ok {
+			context.AuthInfo = newName
 		}
 	}
 
-	if err := clientcmd.WriteToFile(*config, configPath); err != nil {
-		return fmt.Errorf("error writing kubeconfig: %v", err)
+	if err := saveKubeconfig(loadingRules, config); err != nil {
+		return err
 	}
 
-	fmt.Printf("Successfully renamed %d context(s)\n", len(changes))
+	fmt.Printf("Successfully renamed %s\n", describeCounts(map[string]int{
+		"context": len(plan.Contexts),
+		"cluster": len(plan.Clusters),
+		"user":    len(plan.Users),
+	}))
 	return nil
 }
+
+// renameMapKeys moves entries to their new keys. Entries are removed first
+// so that swaps and chains of renames do not clobber each other.
+func renameMapKeys[V any](entries map[string]V, changes []NameChange) {
+	moved := make(map[string]V, len(changes))
+	for _, change := range changes {
+		if entry, exists := entries[change.OldName]; exists {
+			moved[change.NewName] = entry
+			delete(entries, change.OldName)
+		}
+	}
+	for name, entry := range moved {
+		entries[name] = entry
+	}
+}
+
+func changeMap(changes []NameChange) map[string]string {
+	result := make(map[string]string, len(changes))
+	for _, change := range changes {
+		result[change.OldName] = change.NewName
+	}
+	return result
+}
+
+// describeCounts formats non-zero counts as "2 context(s), 1 user(s)" in a
+// fixed kind order
+func describeCounts(counts map[string]int) string {
+	var parts []string
+	for _, kind := range []string{"context", "cluster", "user"} {
+		if counts[kind] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s(s)", counts[kind], kind))
+		}
+	}
+	if len(parts) == 0 {
+		return "nothing"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,130 @@
+package kctx
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestCheckKeyCollisions(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins map[string]string // context name -> origin file
+		changes []NameChange
+		wantErr string
+	}{
+		{
+			name:    "rename to free name",
+			origins: map[string]string{"dev": "a", "prod": "a"},
+			changes: []NameChange{{OldName: "dev", NewName: "staging"}},
+		},
+		{
+			name:    "rename onto existing entry",
+			origins: map[string]string{"dev": "a", "prod": "a"},
+			changes: []NameChange{{OldName: "dev", NewName: "prod"}},
+			wantErr: "cannot rename context 'dev': context 'prod' already exists",
+		},
+		{
+			name:    "two entries renamed to one name",
+			origins: map[string]string{"dev-1": "a", "dev-2": "a"},
+			changes: []NameChange{{OldName: "dev-1", NewName: "dev"}, {OldName: "dev-2", NewName: "dev"}},
+			wantErr: "contexts 'dev-1' and 'dev-2' would both be renamed to 'dev'",
+		},
+		{
+			name:    "chain within one file",
+			origins: map[string]string{"x": "a", "xx": "a"},
+			changes: []NameChange{{OldName: "x", NewName: "xx"}, {OldName: "xx", NewName: "xxx"}},
+		},
+		{
+			name:    "chain across files",
+			origins: map[string]string{"x": "a", "xx": "b"},
+			changes: []NameChange{{OldName: "x", NewName: "xx"}, {OldName: "xx", NewName: "xxx"}},
+			wantErr: "cannot rename context 'x' to 'xx': 'xx' is renamed too but defined in b instead of a",
+		},
+		{
+			name:    "swap within one file",
+			origins: map[string]string{"blue": "a", "green": "a"},
+			changes: []NameChange{{OldName: "blue", NewName: "green"}, {OldName: "green", NewName: "blue"}},
+		},
+		{
+			name:    "swap across files",
+			origins: map[string]string{"blue": "a", "green": "b"},
+			changes: []NameChange{{OldName: "blue", NewName: "green"}, {OldName: "green", NewName: "blue"}},
+			wantErr: "'green' is renamed too but defined in b instead of a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contexts := make(map[string]*clientcmdapi.Context)
+			for name, origin := range tt.origins {
+				contexts[name] = &clientcmdapi.Context{LocationOfOrigin: origin}
+			}
+
+			err := checkKeyCollisions("context", contexts, tt.changes, func(c *clientcmdapi.Context) string {
+				return c.LocationOfOrigin
+			})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenameKeys(t *testing.T) {
+	entries := map[string]int{"x": 1, "xx": 2, "y": 3}
+	got := renameKeys(entries, regexp.MustCompile("^(x+)$"), "${1}x")
+	want := []NameChange{{OldName: "x", NewName: "xx"}, {OldName: "xx", NewName: "xxx"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRenameMapKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries map[string]string
+		changes []NameChange
+		want    map[string]string
+	}{
+		{
+			name:    "simple rename",
+			entries: map[string]string{"dev": "1", "prod": "2"},
+			changes: []NameChange{{OldName: "dev", NewName: "staging"}},
+			want:    map[string]string{"staging": "1", "prod": "2"},
+		},
+		{
+			name:    "chain",
+			entries: map[string]string{"x": "1", "xx": "2"},
+			changes: []NameChange{{OldName: "x", NewName: "xx"}, {OldName: "xx", NewName: "xxx"}},
+			want:    map[string]string{"xx": "1", "xxx": "2"},
+		},
+		{
+			name:    "swap",
+			entries: map[string]string{"blue": "1", "green": "2"},
+			changes: []NameChange{{OldName: "blue", NewName: "green"}, {OldName: "green", NewName: "blue"}},
+			want:    map[string]string{"green": "1", "blue": "2"},
+		},
+		{
+			name:    "missing entry",
+			entries: map[string]string{"dev": "1"},
+			changes: []NameChange{{OldName: "gone", NewName: "here"}},
+			want:    map[string]string{"dev": "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renameMapKeys(tt.entries, tt.changes)
+			if !reflect.DeepEqual(tt.entries, tt.want) {
+				t.Errorf("got %v, want %v", tt.entries, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package kctx
+
+import "fmt"
+
+// UseContext sets current-context to name. A name of "-" switches back to
+// the previously used context.
+func UseContext(name string) error {
+	loadingRules, rawConfig, err := loadKubeconfig()
+	if err != nil {
+		return err
+	}
+
+	h, err := loadHistory()
+	if err != nil {
+		return err
+	}
+
+	if name == "-" {
+		previous, ok := h.previousContext(rawConfig.CurrentContext, func(candidate string) bool {
+			_, exists := rawConfig.Contexts[candidate]
+			return exists
+		})
+		if !ok {
+			return fmt.Errorf("no previous context in history")
+		}
+		name = previous
+	}
+
+	if _, exists := rawConfig.Contexts[name]; !exists {
+		return fmt.Errorf("context '%s' not found in kubeconfig", name)
+	}
+
+	if rawConfig.CurrentContext == name {
+		fmt.Printf("Already using context: %s\n", name)
+		return nil
+	}
+
+	previous := rawConfig.CurrentContext
+	rawConfig.CurrentContext = name
+	if err := saveKubeconfig(loadingRules, rawConfig); err != nil {
+		return err
+	}
+
+	if previous != "" {
+		h.pushContext(previous)
+		if err := h.save(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Switched to context: %s\n", name)
+	return nil
+}
@@ -0,0 +1,462 @@
+package kflap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Rule actions. The stderr action and the output of exec commands are meant
+// for headless and serve modes; the TUI shows their latest lines below the
+// table instead, as writing to the terminal would garble its display.
+const (
+	ActionHighlight = "highlight"
+	ActionStderr    = "stderr"
+	ActionExec      = "exec"
+	ActionWebhook   = "webhook"
+)
+
+// Rule metrics: a change count of one class or of any class within the
+// window, or the rate of changes per minute over the window
+const (
+	MetricChanges  = "changes"
+	MetricSpec     = "spec"
+	MetricStatus   = "status"
+	MetricMetadata = "metadata"
+	MetricRate     = "rate"
+)
+
+const (
+	defaultRuleWindow   = 5 * time.Minute
+	defaultRuleCooldown = 10 * time.Minute
+	actionTimeout       = 30 * time.Second
+	maxNotices          = 5 // Alert output lines shown by the TUI
+)
+
+// Rule fires for every matching resource whose metric over the window
+// exceeds the threshold
+type Rule struct {
+	Name      string    `json:"name"`
+	Match     RuleMatch `json:"match,omitempty"`
+	Metric    string    `json:"metric"`
+	Window    string    `json:"window,omitempty"` // Duration, at most 15m (default 5m)
+	Threshold float64   `json:"threshold"`
+	Actions   []string  `json:"actions"`
+	Command   string    `json:"command,omitempty"`  // Shell command run by the exec action
+	Webhook   string    `json:"webhook,omitempty"`  // URL the webhook action posts to
+	Cooldown  string    `json:"cooldown,omitempty"` // Minimum time between notifications per resource (default 10m)
+
+	window   time.Duration
+	cooldown time.Duration
+}
+
+// RuleMatch selects resources by glob patterns; empty patterns match all
+type RuleMatch struct {
+	Context   string `json:"context,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// Alert is a notification about a resource that crossed a rule's threshold
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Context   string    `json:"context,omitempty"`
+	Group     string    `json:"group,omitempty"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Window    string    `json:"window"`
+	Time      time.Time `json:"time"`
+}
+
+// alertState tracks one rule for one resource across polls
+type alertState struct {
+	firing   bool      // Above the threshold at the last evaluation
+	notified time.Time // Last notification, for the cooldown
+}
+
+// rulesFile is the layout of a rules file
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadRules reads and validates alert rules from a YAML or JSON file such as
+//
+//	rules:
+//	- name: deployment-spec-churn
+//	  match: {kind: Deployment}
+//	  metric: spec
+//	  window: 5m
+//	  threshold: 5
+//	  actions: [highlight, stderr]
+//	- name: prod-changes
+//	  match: {namespace: "prod-*"}
+//	  metric: rate
+//	  window: 1m
+//	  threshold: 30
+//	  actions: [webhook]
+//	  webhook: https://hooks.example.com/kflap
+//
+// Alerts of the stderr action and the output of exec commands go to stderr
+// in headless and serve modes, and below the table in the TUI.
+func LoadRules(filename string) ([]Rule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rules file: %v", err)
+	}
+
+	var file rulesFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing rules file: %v", err)
+	}
+
+	names := make(map[string]bool)
+	for i := range file.Rules {
+		if err := file.Rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid rule '%s': %v", file.Rules[i].Name, err)
+		}
+		if names[file.Rules[i].Name] {
+			return nil, fmt.Errorf("duplicate rule name '%s'", file.Rules[i].Name)
+		}
+		names[file.Rules[i].Name] = true
+	}
+	return file.Rules, nil
+}
+
+// validate checks the rule and fills in its parsed window and cooldown
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	switch r.Metric {
+	case MetricChanges, MetricSpec, MetricStatus, MetricMetadata, MetricRate:
+	default:
+		return fmt.Errorf("invalid metric '%s' (want one of changes, spec, status, metadata, rate)", r.Metric)
+	}
+
+	for _, pattern := range []string{r.Match.Context, r.Match.Kind, r.Match.Namespace, r.Match.Name} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+		}
+	}
+
+	var err error
+	if r.window, err = parseRuleDuration(r.Window, defaultRuleWindow); err != nil {
+		return fmt.Errorf("invalid window: %v", err)
+	}
+	if r.window <= 0 || r.window > maxWindow() {
+		return fmt.Errorf("window must be between 0 and %s", maxWindow())
+	}
+	if r.cooldown, err = parseRuleDuration(r.Cooldown, defaultRuleCooldown); err != nil {
+		return fmt.Errorf("invalid cooldown: %v", err)
+	}
+
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	for _, action := range r.Actions {
+		switch action {
+		case ActionHighlight, ActionStderr:
+		case ActionExec:
+			if r.Command == "" {
+				return fmt.Errorf("the exec action requires a command")
+			}
+		case ActionWebhook:
+			if r.Webhook == "" {
+				return fmt.Errorf("the webhook action requires a webhook URL")
+			}
+		default:
+			return fmt.Errorf("invalid action '%s' (want one of highlight, stderr, exec, webhook)", action)
+		}
+	}
+	return nil
+}
+
+func parseRuleDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// matches reports whether the rule applies to the resource
+func (r *Rule) matches(info *ResourceInfo) bool {
+	for _, m := range []struct{ pattern, value string }{
+		{r.Match.Context, info.Context},
+		{r.Match.Kind, info.Type},
+		{r.Match.Namespace, info.Namespace},
+		{r.Match.Name, info.Name},
+	} {
+		if m.pattern == "" {
+			continue
+		}
+		if matched, _ := path.Match(m.pattern, m.value); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// value returns the rule's metric for the resource over the window ending
+// at now
+func (r *Rule) value(info *ResourceInfo, now time.Time) float64 {
+	switch r.Metric {
+	case MetricRate:
+		return float64(info.changesWithin(now, r.window, "")) / r.window.Minutes()
+	case MetricChanges:
+		return float64(info.changesWithin(now, r.window, ""))
+	default:
+		// The remaining metrics are named like the change classes
+		return float64(info.changesWithin(now, r.window, r.Metric))
+	}
+}
+
+func (r *Rule) hasAction(action string) bool {
+	for _, a := range r.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateRules checks every rule against every resource, records which
+// rules fire on each resource and returns the alerts to notify. A rule
+// notifies once when it starts firing on a resource, and not again for the
+// same resource until it stopped firing and the cooldown passed.
+func (m *Monitor) evaluateRules(now time.Time) []Alert {
+	var alerts []Alert
+	for key, info := range m.resources {
+		var firing []string
+		highlight := false
+
+		for i := range m.config.Rules {
+			rule := &m.config.Rules[i]
+			if !rule.matches(info) {
+				continue
+			}
+
+			stateKey := rule.Name + "\x00" + key
+			state := m.alerts[stateKey]
+			value := rule.value(info, now)
+			if value <= rule.Threshold {
+				if state != nil {
+					state.firing = false
+					if now.Sub(state.notified) >= rule.cooldown {
+						delete(m.alerts, stateKey)
+					}
+				}
+				continue
+			}
+
+			firing = append(firing, rule.Name)
+			highlight = highlight || rule.hasAction(ActionHighlight)
+
+			if state == nil {
+				state = &alertState{}
+				m.alerts[stateKey] = state
+			}
+			if state.firing {
+				continue
+			}
+			state.firing = true
+			if !state.notified.IsZero() && now.Sub(state.notified) < rule.cooldown {
+				continue
+			}
+			state.notified = now
+
+			alerts = append(alerts, Alert{
+				Rule:      rule.Name,
+				Context:   info.Context,
+				Group:     info.Group,
+				Kind:      info.Type,
+				Namespace: info.Namespace,
+				Name:      info.Name,
+				Metric:    rule.Metric,
+				Value:     value,
+				Threshold: rule.Threshold,
+				Window:    rule.window.String(),
+				Time:      now,
+			})
+		}
+
+		info.Alerts = firing
+		info.Highlight = highlight
+	}
+	return alerts
+}
+
+// notify runs the actions of the rules behind alerts. Commands and webhooks
+// run in the background so slow receivers do not hold up polling.
+func (m *Monitor) notify(alerts []Alert) {
+	for _, alert := range alerts {
+		rule := m.rule(alert.Rule)
+		if rule == nil {
+			continue
+		}
+		for _, action := range rule.Actions {
+			switch action {
+			case ActionStderr:
+				fmt.Fprintf(m.alertWriter(), "Alert %s: %s %s has %s %g > %g over %s\n",
+					alert.Rule, alert.Kind, alertName(alert), alert.Metric, alert.Value, alert.Threshold, alert.Window)
+			case ActionExec:
+				go runAlertCommand(m.alertWriter(), rule.Command, alert)
+			case ActionWebhook:
+				go postAlert(m.alertWriter(), rule.Webhook, alert)
+			}
+		}
+	}
+}
+
+// alertWriter returns where alerts, command output and action errors are
+// written: stderr unless the TUI redirected them
+func (m *Monitor) alertWriter() io.Writer {
+	if m.alertOut != nil {
+		return m.alertOut
+	}
+	return os.Stderr
+}
+
+// setAlertOutput redirects the alert output of the monitor and its members
+// to w
+func (m *Monitor) setAlertOutput(w io.Writer) {
+	m.alertOut = w
+	for _, cluster := range m.clusters {
+		cluster.alertOut = w
+	}
+}
+
+func (m *Monitor) rule(name string) *Rule {
+	for i := range m.config.Rules {
+		if m.config.Rules[i].Name == name {
+			return &m.config.Rules[i]
+		}
+	}
+	return nil
+}
+
+// runAlertCommand runs command with sh, passing the alert as JSON on stdin
+// and its fields in KFLAP_* environment variables. The command's output and
+// errors go to out.
+func runAlertCommand(out io.Writer, command string, alert Alert) {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		fmt.Fprintf(out, "Error: error encoding alert: %v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Env = append(os.Environ(),
+		"KFLAP_RULE="+alert.Rule,
+		"KFLAP_CONTEXT="+alert.Context,
+		"KFLAP_GROUP="+alert.Group,
+		"KFLAP_KIND="+alert.Kind,
+		"KFLAP_NAMESPACE="+alert.Namespace,
+		"KFLAP_NAME="+alert.Name,
+		"KFLAP_METRIC="+alert.Metric,
+		fmt.Sprintf("KFLAP_VALUE=%g", alert.Value),
+		fmt.Sprintf("KFLAP_THRESHOLD=%g", alert.Threshold),
+		"KFLAP_WINDOW="+alert.Window,
+	)
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(out, "Error: error running alert command for rule '%s': %v\n", alert.Rule, err)
+	}
+}
+
+// postAlert posts the alert as JSON to url, writing errors to out
+func postAlert(out io.Writer, url string, alert Alert) {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		fmt.Fprintf(out, "Error: error encoding alert: %v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		fmt.Fprintf(out, "Error: error creating webhook request for rule '%s': %v\n", alert.Rule, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(out, "Error: error posting alert for rule '%s': %v\n", alert.Rule, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(out, "Error: webhook for rule '%s' returned %s\n", alert.Rule, resp.Status)
+	}
+}
+
+// noticeLog keeps the most recent lines written to it, for the TUI to show
+// alert output without writing to the terminal. Commands write to it from
+// their own goroutines.
+type noticeLog struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *noticeLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range strings.Split(string(p), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			l.lines = append(l.lines, line)
+		}
+	}
+	if len(l.lines) > maxNotices {
+		l.lines = l.lines[len(l.lines)-maxNotices:]
+	}
+	return len(p), nil
+}
+
+// recent returns the most recent lines, oldest first
+func (l *noticeLog) recent() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+// alertName returns the qualified name of the alert's resource, prefixed
+// with the context when monitoring several clusters
+func alertName(alert Alert) string {
+	if alert.Context != "" {
+		return alert.Context + ":" + qualifiedName(alert.Namespace, alert.Name)
+	}
+	return qualifiedName(alert.Namespace, alert.Name)
+}
+
+// qualifiedName returns namespace/name, or just name for cluster-scoped
+// resources
+func qualifiedName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
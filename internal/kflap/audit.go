@@ -0,0 +1,211 @@
+package kflap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// auditEvent holds the fields of an API server audit event that kflap uses
+type auditEvent struct {
+	Stage          string    `json:"stage"`
+	Verb           string    `json:"verb"`
+	RequestURI     string    `json:"requestURI"`
+	UserAgent      string    `json:"userAgent"`
+	StageTimestamp time.Time `json:"stageTimestamp"`
+	ObjectRef      *struct {
+		APIGroup        string `json:"apiGroup"`
+		APIVersion      string `json:"apiVersion"`
+		Resource        string `json:"resource"`
+		Subresource     string `json:"subresource"`
+		Namespace       string `json:"namespace"`
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"objectRef"`
+	ResponseStatus *struct {
+		Code int `json:"code"`
+	} `json:"responseStatus"`
+	// Only logged at the RequestResponse level
+	ResponseObject *struct {
+		Kind     string            `json:"kind"`
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	} `json:"responseObject"`
+}
+
+// loadAuditLogs reads the successful updates and patches from audit log
+// files, which may be gzipped, as changes. The audit log only tells the
+// resource type of a request; the kind is taken from response objects when
+// the log level includes them.
+func loadAuditLogs(filenames []string) ([]recordedChange, error) {
+	var events []auditEvent
+	for _, filename := range filenames {
+		fileEvents, err := readAuditLog(filename)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, fileEvents...)
+	}
+
+	// Rotated logs may be given in any order, and classifying a change
+	// depends on the one before it
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StageTimestamp.Before(events[j].StageTimestamp)
+	})
+
+	kinds := make(map[string]string)
+	for _, event := range events {
+		if event.ResponseObject != nil && event.ResponseObject.Kind != "" {
+			kinds[event.ObjectRef.APIGroup+"/"+event.ObjectRef.Resource] = event.ResponseObject.Kind
+		}
+	}
+
+	// Scratch state per resource to classify changes and skip no-ops
+	previous := make(map[string]*ResourceInfo)
+
+	var changes []recordedChange
+	for _, event := range events {
+		ref := event.ObjectRef
+		kind := kinds[ref.APIGroup+"/"+ref.Resource]
+		if kind == "" {
+			kind = ref.Resource
+		}
+
+		change := recordedChange{
+			Time:      event.StageTimestamp,
+			Group:     ref.APIGroup,
+			Version:   ref.APIVersion,
+			Resource:  ref.Resource,
+			Kind:      kind,
+			Namespace: ref.Namespace,
+			Name:      ref.Name,
+			Manager:   auditManager(event),
+			Class:     classSpec,
+		}
+		if ref.Subresource == "status" {
+			change.Class = classStatus
+		}
+
+		resourceVersion := ref.ResourceVersion
+		if event.ResponseObject != nil {
+			resourceVersion = event.ResponseObject.Metadata.ResourceVersion
+		}
+		change.ResourceVersion, _ = strconv.ParseInt(resourceVersion, 10, 64)
+
+		if event.ResponseObject != nil {
+			meta := &event.ResponseObject.Metadata
+
+			key := resourceKey(ref.Namespace, kind, ref.Name)
+			info, seen := previous[key]
+			switch {
+			case !seen:
+				info = &ResourceInfo{ResourceVersion: change.ResourceVersion}
+				observeClassifiers(info, meta)
+				previous[key] = info
+			case change.ResourceVersion != 0 && change.ResourceVersion == info.ResourceVersion:
+				// The API server does not persist updates that change nothing
+				continue
+			default:
+				info.ResourceVersion = change.ResourceVersion
+				if class := classifyChange(info, meta); ref.Subresource == "" {
+					change.Class = class
+				}
+			}
+		}
+
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// readAuditLog reads the events of one audit log file that describe a
+// persisted update of a named object
+func readAuditLog(filename string) ([]auditEvent, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %v", err)
+	}
+	defer file.Close()
+
+	// Rotated logs are often compressed without a telling name
+	var r io.Reader = bufio.NewReader(file)
+	if magic, _ := r.(*bufio.Reader).Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading audit log %s: %v", filename, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var events []auditEvent
+	skipped := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordedLine)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event auditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// Logs cut off by rotation end in a partial line
+			skipped++
+			continue
+		}
+		if !persistedUpdate(event) {
+			continue
+		}
+		if event.ResponseObject != nil {
+			event.ResponseObject.Metadata.ManagedFields = nil
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log %s: %v", filename, err)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d unparseable lines in %s\n", skipped, filename)
+	}
+	return events, nil
+}
+
+// persistedUpdate reports whether the event is the completed, successful,
+// non-dry-run update or patch of a named object
+func persistedUpdate(event auditEvent) bool {
+	if event.Stage != "ResponseComplete" || (event.Verb != "update" && event.Verb != "patch") {
+		return false
+	}
+	if event.ObjectRef == nil || event.ObjectRef.Name == "" {
+		return false
+	}
+	if event.ResponseStatus == nil || event.ResponseStatus.Code < 200 || event.ResponseStatus.Code >= 300 {
+		return false
+	}
+	if uri, err := url.Parse(event.RequestURI); err == nil && uri.Query().Has("dryRun") {
+		return false
+	}
+	return true
+}
+
+// auditManager returns the field manager the API server attributed the
+// request to: the fieldManager parameter, or else the user agent up to the
+// first slash
+func auditManager(event auditEvent) string {
+	if uri, err := url.Parse(event.RequestURI); err == nil {
+		if manager := uri.Query().Get("fieldManager"); manager != "" {
+			return manager
+		}
+	}
+	manager, _, _ := strings.Cut(event.UserAgent, "/")
+	return manager
+}
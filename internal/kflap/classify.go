@@ -0,0 +1,114 @@
+package kflap
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// observeClassifiers remembers the generation, labels/annotations and, for
+// full objects, the spec and status of a newly seen resource so its first
+// change can be classified
+func observeClassifiers(info *ResourceInfo, obj metav1.Object) {
+	info.generation = obj.GetGeneration()
+	info.labelsHash = labelsHash(obj)
+	info.specHash, info.statusHash, _ = contentHashes(obj)
+}
+
+// Change classes, named like the matching sort keys
+const (
+	classSpec     = SortBySpec
+	classStatus   = SortByStatus
+	classMetadata = SortByMeta
+)
+
+// classifyChange counts and returns the class of a change of the resource:
+// spec when the generation was bumped, metadata when only labels,
+// annotations or, for full objects, other metadata changed, and status
+// otherwise. Objects that do not track a generation, such as ConfigMaps and
+// Nodes, are classified by comparing their status with the rest of their
+// content when full objects are fetched; without full objects their changes
+// cannot be told apart and count as status changes.
+func classifyChange(info *ResourceInfo, obj metav1.Object) string {
+	generation, hash := obj.GetGeneration(), labelsHash(obj)
+	specHash, statusHash, full := contentHashes(obj)
+
+	var class string
+	switch {
+	case generation != info.generation:
+		info.SpecChanges++
+		class = classSpec
+	case hash != info.labelsHash:
+		info.MetadataChanges++
+		class = classMetadata
+	case generation == 0 && full && specHash != info.specHash:
+		info.SpecChanges++
+		class = classSpec
+	case full && statusHash == info.statusHash && specHash == info.specHash:
+		// Other metadata, such as finalizers or owner references
+		info.MetadataChanges++
+		class = classMetadata
+	default:
+		info.StatusChanges++
+		class = classStatus
+	}
+
+	info.generation, info.labelsHash = generation, hash
+	info.specHash, info.statusHash = specHash, statusHash
+	return class
+}
+
+// contentHashes hashes the status of a full object and, separately,
+// everything else but the metadata, which holds the spec or the data of
+// objects without one. ok is false for metadata-only objects.
+func contentHashes(obj metav1.Object) (spec, status uint64, ok bool) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return 0, 0, false
+	}
+
+	content := make(map[string]interface{}, len(u.Object))
+	for k, v := range u.Object {
+		if k != "metadata" && k != "status" {
+			content[k] = v
+		}
+	}
+	return hashJSON(content), hashJSON(u.Object["status"]), true
+}
+
+// hashJSON hashes the JSON encoding of v. Maps are encoded with sorted keys,
+// so equal content hashes equally.
+func hashJSON(v interface{}) uint64 {
+	data, _ := json.Marshal(v)
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return h.Sum64()
+}
+
+// statusOnly reports whether every change of the resource was a status change
+func (r *ResourceInfo) statusOnly() bool {
+	return r.StatusChanges > 0 && r.SpecChanges == 0 && r.MetadataChanges == 0
+}
+
+// labelsHash hashes the labels and annotations of obj
+func labelsHash(obj metav1.Object) uint64 {
+	h := fnv.New64a()
+	for _, m := range []map[string]string{obj.GetLabels(), obj.GetAnnotations()} {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			_, _ = h.Write([]byte(k))
+			_, _ = h.Write([]byte{0})
+			_, _ = h.Write([]byte(m[k]))
+			_, _ = h.Write([]byte{0})
+		}
+		_, _ = h.Write([]byte{1})
+	}
+	return h.Sum64()
+}
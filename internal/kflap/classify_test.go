@@ -0,0 +1,137 @@
+package kflap
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// fullObject returns a full object with the given generation, labels, spec
+// and status; nil maps are left out
+func fullObject(generation int64, labels map[string]string, spec, status map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Test"}}
+	u.SetName("test")
+	u.SetGeneration(generation)
+	u.SetLabels(labels)
+	if spec != nil {
+		u.Object["spec"] = spec
+	}
+	if status != nil {
+		u.Object["status"] = status
+	}
+	return u
+}
+
+func TestClassifyChange(t *testing.T) {
+	tests := []struct {
+		name   string
+		before metav1.Object
+		after  metav1.Object
+		want   string
+	}{
+		{
+			name:   "generation bump",
+			before: &metav1.ObjectMeta{Generation: 1},
+			after:  &metav1.ObjectMeta{Generation: 2},
+			want:   classSpec,
+		},
+		{
+			name:   "label change",
+			before: &metav1.ObjectMeta{Generation: 1, Labels: map[string]string{"a": "1"}},
+			after:  &metav1.ObjectMeta{Generation: 1, Labels: map[string]string{"a": "2"}},
+			want:   classMetadata,
+		},
+		{
+			name:   "annotation change",
+			before: &metav1.ObjectMeta{Generation: 1},
+			after:  &metav1.ObjectMeta{Generation: 1, Annotations: map[string]string{"a": "1"}},
+			want:   classMetadata,
+		},
+		{
+			name:   "same generation",
+			before: &metav1.ObjectMeta{Generation: 1},
+			after:  &metav1.ObjectMeta{Generation: 1},
+			want:   classStatus,
+		},
+		{
+			name:   "no generation, metadata only",
+			before: &metav1.ObjectMeta{},
+			after:  &metav1.ObjectMeta{},
+			want:   classStatus,
+		},
+		{
+			name:   "no generation, status change",
+			before: fullObject(0, nil, map[string]interface{}{"unschedulable": false}, map[string]interface{}{"heartbeat": "1"}),
+			after:  fullObject(0, nil, map[string]interface{}{"unschedulable": false}, map[string]interface{}{"heartbeat": "2"}),
+			want:   classStatus,
+		},
+		{
+			name:   "no generation, spec change",
+			before: fullObject(0, nil, map[string]interface{}{"unschedulable": false}, map[string]interface{}{"heartbeat": "1"}),
+			after:  fullObject(0, nil, map[string]interface{}{"unschedulable": true}, map[string]interface{}{"heartbeat": "1"}),
+			want:   classSpec,
+		},
+		{
+			name:   "no generation, data change",
+			before: &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{"k": "1"}}},
+			after:  &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{"k": "2"}}},
+			want:   classSpec,
+		},
+		{
+			name:   "full object, other metadata change",
+			before: fullObject(1, nil, map[string]interface{}{"replicas": 1}, nil),
+			after: func() metav1.Object {
+				u := fullObject(1, nil, map[string]interface{}{"replicas": 1}, nil)
+				u.SetFinalizers([]string{"example.com/cleanup"})
+				return u
+			}(),
+			want: classMetadata,
+		},
+		{
+			name:   "full object, status change",
+			before: fullObject(1, nil, map[string]interface{}{"replicas": 1}, map[string]interface{}{"ready": 0}),
+			after:  fullObject(1, nil, map[string]interface{}{"replicas": 1}, map[string]interface{}{"ready": 1}),
+			want:   classStatus,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &ResourceInfo{}
+			observeClassifiers(info, tt.before)
+
+			if got := classifyChange(info, tt.after); got != tt.want {
+				t.Errorf("got class %s, want %s", got, tt.want)
+			}
+			counts := map[string]int64{classSpec: info.SpecChanges, classStatus: info.StatusChanges, classMetadata: info.MetadataChanges}
+			for class, count := range counts {
+				want := int64(0)
+				if class == tt.want {
+					want = 1
+				}
+				if count != want {
+					t.Errorf("%s changes = %d, want %d", class, count, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusOnly(t *testing.T) {
+	tests := []struct {
+		info ResourceInfo
+		want bool
+	}{
+		{info: ResourceInfo{}, want: false},
+		{info: ResourceInfo{StatusChanges: 3}, want: true},
+		{info: ResourceInfo{StatusChanges: 3, SpecChanges: 1}, want: false},
+		{info: ResourceInfo{StatusChanges: 3, MetadataChanges: 1}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.info.statusOnly(); got != tt.want {
+			t.Errorf("statusOnly() of %+v = %v, want %v", tt.info, got, tt.want)
+		}
+	}
+}
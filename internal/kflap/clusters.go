@@ -0,0 +1,166 @@
+package kflap
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ClusterStatus describes one cluster of a multi-context monitor
+type ClusterStatus struct {
+	Context   string
+	Resources int   // Resources tracked in the cluster
+	Err       error // Error of the most recent poll, if it failed
+}
+
+// ResolveContexts returns the kubeconfig contexts to monitor: the named
+// ones, followed by all contexts or those matching pattern in name order.
+// Named contexts must exist; an empty result means the current context.
+func ResolveContexts(names []string, all bool, pattern string) ([]string, error) {
+	if len(names) == 0 && !all && pattern == "" {
+		return nil, nil
+	}
+
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid context regex: %v", err)
+		}
+	}
+
+	kubeConfig, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+
+	var contexts []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := kubeConfig.Contexts[name]; !ok {
+			return nil, fmt.Errorf("context '%s' not found in kubeconfig", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			contexts = append(contexts, name)
+		}
+	}
+
+	if all || re != nil {
+		available := make([]string, 0, len(kubeConfig.Contexts))
+		for name := range kubeConfig.Contexts {
+			available = append(available, name)
+		}
+		sort.Strings(available)
+		for _, name := range available {
+			if !seen[name] && (all || re.MatchString(name)) {
+				seen[name] = true
+				contexts = append(contexts, name)
+			}
+		}
+	}
+
+	if len(contexts) == 0 {
+		if all {
+			return nil, fmt.Errorf("kubeconfig has no contexts")
+		}
+		return nil, fmt.Errorf("no context matches '%s'", pattern)
+	}
+	return contexts, nil
+}
+
+// multiCluster reports whether the configuration monitors several clusters,
+// so rows need a context column
+func (c Config) multiCluster() bool {
+	return len(c.Contexts) > 1
+}
+
+// newMultiMonitor creates a monitor with one member monitor per configured
+// context. The members share the recording, if any. A context whose
+// clients cannot be created, such as one with a missing certificate, gets
+// a member that only reports the error, so the other clusters are still
+// monitored.
+func newMultiMonitor(config Config, rec *recorder) (*Monitor, error) {
+	// Invalid filters would fail every member alike
+	if _, err := newFilters(config); err != nil {
+		return nil, err
+	}
+
+	m := &Monitor{
+		config:      config,
+		resources:   make(map[string]*ResourceInfo),
+		alerts:      make(map[string]*alertState),
+		clock:       time.Now,
+		recorder:    rec,
+		clusterErrs: make([]error, len(config.Contexts)),
+	}
+
+	for i, name := range config.Contexts {
+		cluster, err := newClusterMonitor(config, name, rec)
+		if err != nil {
+			cluster = &Monitor{
+				config:    config,
+				resources: make(map[string]*ResourceInfo),
+				alerts:    make(map[string]*alertState),
+				clock:     time.Now,
+				setupErr:  err,
+			}
+			m.clusterErrs[i] = err
+		}
+		cluster.context = name
+		m.clusters = append(m.clusters, cluster)
+	}
+	return m, nil
+}
+
+// pollClusters polls every cluster concurrently. A failing cluster does not
+// fail the poll unless all of them fail; Clusters reports the errors.
+func (m *Monitor) pollClusters() error {
+	errs := make([]error, len(m.clusters))
+	var wg sync.WaitGroup
+	for i, cluster := range m.clusters {
+		if cluster.setupErr != nil {
+			errs[i] = cluster.setupErr
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = cluster.Poll()
+		}()
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	copy(m.clusterErrs, errs)
+	m.mu.Unlock()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("every context failed, %s: %v", m.clusters[0].context, errs[0])
+}
+
+// Clusters returns the status of each cluster of a multi-context monitor,
+// or nil for a single cluster
+func (m *Monitor) Clusters() []ClusterStatus {
+	if len(m.clusters) == 0 {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	statuses := make([]ClusterStatus, len(m.clusters))
+	for i, cluster := range m.clusters {
+		cluster.mu.RLock()
+		statuses[i] = ClusterStatus{Context: cluster.context, Resources: len(cluster.resources), Err: m.clusterErrs[i]}
+		cluster.mu.RUnlock()
+	}
+	return statuses
+}
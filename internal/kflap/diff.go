@@ -0,0 +1,239 @@
+package kflap
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DefaultIgnorePaths are field paths that change on almost every update
+// without saying anything about why the object changed
+var DefaultIgnorePaths = []string{
+	"metadata.managedFields",
+	"lastHeartbeatTime",
+}
+
+// redactedValue replaces values of Secret data in diffs
+const redactedValue = "<redacted>"
+
+// secretPaths hold Secret contents, directly or as a copy of the applied
+// object
+var secretPaths = []string{
+	"data",
+	"stringData",
+	`metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`,
+}
+
+// FieldChange is a single field that differs between two versions of an
+// object. Old and New hold JSON-encoded values and are empty when the field
+// is absent from that version.
+type FieldChange struct {
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// Diff holds the field changes of one observed update
+type Diff struct {
+	Time            time.Time     `json:"time"`
+	ResourceVersion int64         `json:"resourceVersion"`
+	Changes         []FieldChange `json:"changes"`
+}
+
+// recordDiff compares obj with the previous snapshot stored under key,
+// prepends the result to info.Diffs, stores obj as the new snapshot and
+// returns the diff. Only full objects can be diffed; for metadata-only
+// objects nil is returned. Values of Secret data are redacted.
+func (m *Monitor) recordDiff(key string, gvr schema.GroupVersionResource, info *ResourceInfo, obj metav1.Object, t time.Time) *Diff {
+	if m.config.Diffs <= 0 {
+		return nil
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil
+	}
+
+	previous, ok := m.snapshots[key]
+	m.snapshots[key] = u.Object
+	if !ok {
+		return nil
+	}
+
+	diff := Diff{
+		Time:            t,
+		ResourceVersion: info.ResourceVersion,
+		Changes:         diffValues("", previous, u.Object, m.config.IgnorePaths),
+	}
+	if gvr.Group == "" && gvr.Resource == "secrets" {
+		redactSecretValues(diff.Changes)
+	}
+	m.addDiff(info, diff)
+	return &diff
+}
+
+// redactSecretValues hides the values of changes to Secret contents,
+// keeping only whether the field was added, removed or changed
+func redactSecretValues(changes []FieldChange) {
+	for i := range changes {
+		if !secretPath(changes[i].Path) {
+			continue
+		}
+		if changes[i].Old != "" {
+			changes[i].Old = redactedValue
+		}
+		if changes[i].New != "" {
+			changes[i].New = redactedValue
+		}
+	}
+}
+
+// secretPath reports whether p is or lies below one of secretPaths
+func secretPath(p string) bool {
+	for _, sp := range secretPaths {
+		if p == sp || strings.HasPrefix(p, sp+".") || strings.HasPrefix(p, sp+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// addDiff prepends diff to info.Diffs, keeping at most the configured number
+// of diffs. A new slice is built so copies handed out by GetResources stay
+// unchanged.
+func (m *Monitor) addDiff(info *ResourceInfo, diff Diff) {
+	diffs := make([]Diff, 0, min(len(info.Diffs)+1, m.config.Diffs))
+	diffs = append(diffs, diff)
+	for _, d := range info.Diffs {
+		if len(diffs) == m.config.Diffs {
+			break
+		}
+		diffs = append(diffs, d)
+	}
+	info.Diffs = diffs
+}
+
+// storeSnapshot remembers obj as the baseline for the next diff of key
+func (m *Monitor) storeSnapshot(key string, obj metav1.Object) {
+	if m.config.Diffs <= 0 {
+		return
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		m.snapshots[key] = u.Object
+	}
+}
+
+// diffValues returns the changes between old and new below prefix, sorted by
+// path. Maps are compared key by key and lists index by index.
+func diffValues(prefix string, old, new interface{}, ignore []string) []FieldChange {
+	if prefix == "metadata.resourceVersion" || ignoredPath(prefix, ignore) {
+		return nil
+	}
+
+	switch oldValue := old.(type) {
+	case map[string]interface{}:
+		newValue, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		var changes []FieldChange
+		for _, k := range unionKeys(oldValue, newValue) {
+			changes = append(changes, diffValues(joinPath(prefix, k), oldValue[k], newValue[k], ignore)...)
+		}
+		return changes
+
+	case []interface{}:
+		newValue, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		var changes []FieldChange
+		for i := 0; i < max(len(oldValue), len(newValue)); i++ {
+			var o, n interface{}
+			if i < len(oldValue) {
+				o = oldValue[i]
+			}
+			if i < len(newValue) {
+				n = newValue[i]
+			}
+			changes = append(changes, diffValues(fmt.Sprintf("%s[%d]", prefix, i), o, n, ignore)...)
+		}
+		return changes
+	}
+
+	oldJSON, newJSON := encodeValue(old), encodeValue(new)
+	if oldJSON == newJSON {
+		return nil
+	}
+	return []FieldChange{{Path: prefix, Old: oldJSON, New: newJSON}}
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// joinPath appends a map key to a field path, quoting keys that contain
+// dots such as annotation names
+func joinPath(prefix, key string) string {
+	if strings.ContainsAny(key, ".[]") {
+		return fmt.Sprintf("%s[%q]", prefix, key)
+	}
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// ignoredPath reports whether p matches one of the ignore patterns. A
+// pattern matches the path itself and everything below it, may use
+// path.Match wildcards, and when it has no dots also matches any field of
+// that name at any depth.
+func ignoredPath(p string, ignore []string) bool {
+	if p == "" {
+		return false
+	}
+	last := p
+	if i := strings.LastIndexAny(p, ".]"); i >= 0 {
+		last = p[i+1:]
+	}
+
+	for _, pattern := range ignore {
+		if p == pattern || strings.HasPrefix(p, pattern+".") || strings.HasPrefix(p, pattern+"[") {
+			return true
+		}
+		if matched, _ := path.Match(pattern, p); matched {
+			return true
+		}
+		if !strings.Contains(pattern, ".") && last == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
@@ -0,0 +1,108 @@
+package kflap
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// namePattern matches names with a glob, or with a regular expression when
+// written between slashes such as /^kube-/
+type namePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func compilePatterns(patterns []string) ([]namePattern, error) {
+	compiled := make([]namePattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+			}
+			compiled = append(compiled, namePattern{re: re})
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+		}
+		compiled = append(compiled, namePattern{glob: pattern})
+	}
+	return compiled, nil
+}
+
+func (p namePattern) matches(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	matched, _ := path.Match(p.glob, name)
+	return matched
+}
+
+// matchesAny reports whether any pattern matches any of the names
+func matchesAny(patterns []namePattern, names ...string) bool {
+	for _, p := range patterns {
+		for _, name := range names {
+			if p.matches(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filters holds the parsed selectors and exclusions of a config
+type filters struct {
+	excludeResources  []namePattern
+	excludeNamespaces []namePattern
+}
+
+// newFilters validates the selectors and compiles the exclusions of config
+func newFilters(config Config) (filters, error) {
+	if _, err := labels.Parse(config.LabelSelector); err != nil {
+		return filters{}, fmt.Errorf("invalid label selector: %v", err)
+	}
+	if _, err := fields.ParseSelector(config.FieldSelector); err != nil {
+		return filters{}, fmt.Errorf("invalid field selector: %v", err)
+	}
+
+	var f filters
+	var err error
+	if f.excludeResources, err = compilePatterns(config.ExcludeResources); err != nil {
+		return filters{}, fmt.Errorf("error in excluded resources: %v", err)
+	}
+	if f.excludeNamespaces, err = compilePatterns(config.ExcludeNamespaces); err != nil {
+		return filters{}, fmt.Errorf("error in excluded namespaces: %v", err)
+	}
+	return f, nil
+}
+
+// excludedResource reports whether a resource type is excluded by its
+// plural name, its kind or its name qualified with the group
+func (f filters) excludedResource(resource apiResourceInfo) bool {
+	names := []string{resource.Name, resource.Kind}
+	if resource.Group != "" {
+		names = append(names, resource.Name+"."+resource.Group)
+	}
+	return matchesAny(f.excludeResources, names...)
+}
+
+// excludedNamespace reports whether objects in namespace are excluded.
+// Cluster-scoped objects never are.
+func (f filters) excludedNamespace(namespace string) bool {
+	return namespace != "" && matchesAny(f.excludeNamespaces, namespace)
+}
+
+// listOptions returns the list options carrying the configured selectors
+func (m *Monitor) listOptions() metav1.ListOptions {
+	return metav1.ListOptions{
+		LabelSelector: m.config.LabelSelector,
+		FieldSelector: m.config.FieldSelector,
+	}
+}
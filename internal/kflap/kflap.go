@@ -1,15 +1,45 @@
 package kflap
 
 import (
+	"time"
+
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 // Config holds the configuration for the kflap monitor
 type Config struct {
-	Resources  []string // Resource types to monitor (empty = all)
-	Namespaces []string // Namespaces to monitor (empty = all)
-	Interval   int      // Polling interval in seconds
-	Limit      int      // Number of rows to display
+	Contexts          []string      // Kubeconfig contexts of the clusters to monitor (empty = current)
+	Resources         []string      // Resource types to monitor (empty = all)
+	Namespaces        []string      // Namespaces to monitor (empty = all)
+	LabelSelector     string        // Label selector passed to list and watch requests
+	FieldSelector     string        // Field selector passed to list and watch requests
+	ExcludeResources  []string      // Resource types left out, as globs or /regex/ patterns
+	ExcludeNamespaces []string      // Namespaces left out, as globs or /regex/ patterns
+	Interval          int           // Polling interval in seconds
+	Limit             int           // Number of rows to display or resources to export (0 = all)
+	Watch             bool          // Use watch streams instead of re-listing on every poll
+	PageSize          int64         // Objects per list request (0 = no pagination)
+	Workers           int           // Lists fetched concurrently when polling (0 = 1)
+	QPS               float32       // Client-side request rate limit per cluster (0 = client-go default)
+	Burst             int           // Client-side request burst per cluster (0 = client-go default)
+	RequestTimeout    time.Duration // Timeout of each list request when polling (0 = none)
+	FullObjects       bool          // Fetch full objects instead of metadata only
+	SortBy            string        // Initial sort key, one of SortKeys
+	Diffs             int           // Field-level diffs kept per resource (0 = disabled, implies FullObjects)
+	IgnorePaths       []string      // Field path patterns left out of diffs
+	Oscillation       bool          // Detect resources returning to earlier content states (implies FullObjects)
+	HashStatus        bool          // Include status in the content compared for oscillation
+	Fights            bool          // Keep the managed fields of every object to detect managers fighting over them
+	HideStatusOnly    bool          // Initially hide resources whose changes were all status changes
+	Output            string        // Headless output format, one of OutputFormats (empty = TUI)
+	Duration          time.Duration // Headless: write a single snapshot after this long (0 = after every poll)
+	Listen            string        // Serve: address the metrics server listens on
+	MaxSeries         int           // Serve: cap on per-resource metric series (0 = no cap)
+	Rules             []Rule        // Alert rules evaluated after each poll
+	Record            string        // File observed changes are appended to (empty = no recording)
+	Replay            string        // Recording to replay instead of monitoring a cluster
+	AuditLogs         []string      // Audit log files to replay instead of monitoring a cluster
+	Speed             float64       // Replay speed relative to real time (0 = apply all changes at once)
 }
 
 // Run starts the kflap TUI
@@ -19,9 +49,16 @@ func Run(config Config) error {
 	if err != nil {
 		return err
 	}
+	defer monitor.Close()
+
+	// Alert output would garble the display, so it is shown in the TUI
+	notices := &noticeLog{}
+	monitor.setAlertOutput(notices)
 
 	// Create and start the TUI program
-	p := tea.NewProgram(newModel(monitor, config))
+	model := newModel(monitor, config)
+	model.notices = notices
+	p := tea.NewProgram(model)
 	_, err = p.Run()
 	return err
 }
@@ -0,0 +1,352 @@
+package kflap
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fightWindow is how far apart two takeovers of the same fields may be to
+// count as a fight, and how long a fight stays flagged afterwards
+const fightWindow = 15 * time.Minute
+
+// maxTakeovers bounds the ownership transfers remembered per resource
+const maxTakeovers = 20
+
+// Fight describes two field managers alternately taking the same fields over
+// from each other
+type Fight struct {
+	Managers []string  `json:"managers"` // The two managers, sorted
+	Fields   []string  `json:"fields"`   // Fields that changed hands in both directions
+	Time     time.Time `json:"time"`     // Last time one of the managers took the fields over
+}
+
+// ManagerStats aggregates the updates of one field manager across resources
+type ManagerStats struct {
+	Manager   string
+	Updates   int64 // Updates attributed to the manager
+	Resources int   // Resources the manager updated
+	Fights    int   // Resources on which the manager is in a fight
+}
+
+// takeover records a manager gaining fields that another manager lost in
+// the same update
+type takeover struct {
+	time   time.Time
+	from   string
+	to     string
+	fields []string
+}
+
+// ownership is the managedFields of an object by manager name. Entries of
+// one manager for different operations or subresources are merged.
+type ownership map[string]ownedFields
+
+// ownedFields keeps a hash of a manager's field sets, which is enough to
+// attribute updates. The fields themselves are only decoded and kept when
+// fights are detected, as they would otherwise dominate memory use on
+// large clusters.
+type ownedFields struct {
+	time   time.Time       // Most recent update by the manager
+	hash   uint64          // Hash of the raw field sets of the manager
+	fields map[string]bool // Leaf field paths owned by the manager, if tracked
+}
+
+// storeOwnership remembers the field ownership of a newly seen resource and
+// shows its most recent manager without counting an update
+func (m *Monitor) storeOwnership(key string, info *ResourceInfo, obj metav1.Object) {
+	owners := managedOwnership(obj, m.config.Fights)
+	if owners == nil {
+		return
+	}
+	m.owners[key] = owners
+	info.Manager = owners.lastManager()
+}
+
+// recordManager attributes an update of the resource stored under key to
+// the field manager that performed it, flags a fight when fights are
+// detected and two managers keep taking the same fields from each other,
+// and returns the manager, or "" when the object has no managedFields
+func (m *Monitor) recordManager(key string, info *ResourceInfo, obj metav1.Object, t time.Time) string {
+	current := managedOwnership(obj, m.config.Fights)
+	previous := m.owners[key]
+	if current == nil {
+		delete(m.owners, key)
+		return ""
+	}
+	m.owners[key] = current
+
+	manager := updater(previous, current)
+	info.Manager = manager
+	info.Managers = increment(info.Managers, manager)
+	if !m.config.Fights {
+		return manager
+	}
+
+	for _, to := range takeovers(manager, previous, current, t) {
+		for _, earlier := range info.takeovers {
+			if earlier.from != to.to || earlier.to != to.from || t.Sub(earlier.time) > fightWindow {
+				continue
+			}
+			if fields := intersect(earlier.fields, to.fields); len(fields) > 0 {
+				managers := []string{to.from, to.to}
+				sort.Strings(managers)
+				info.Fight = &Fight{Managers: managers, Fields: fields, Time: t}
+			}
+		}
+		info.takeovers = append(info.takeovers, to)
+	}
+
+	// Forget takeovers that can no longer be part of a fight
+	i := 0
+	for i < len(info.takeovers) && (t.Sub(info.takeovers[i].time) > fightWindow || len(info.takeovers)-i > maxTakeovers) {
+		i++
+	}
+	info.takeovers = info.takeovers[i:]
+	return manager
+}
+
+// managedOwnership collects the hash of the fields owned by each manager of
+// obj, and the fields themselves when withFields is set, or nil if the
+// object has no managedFields
+func managedOwnership(obj metav1.Object, withFields bool) ownership {
+	entries := obj.GetManagedFields()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	owners := make(ownership, len(entries))
+	for _, entry := range entries {
+		owned := owners[entry.Manager]
+		if withFields && owned.fields == nil {
+			owned.fields = make(map[string]bool)
+		}
+		if entry.Time != nil && entry.Time.After(owned.time) {
+			owned.time = entry.Time.Time
+		}
+		if entry.FieldsV1 != nil {
+			// Entries are combined so the hash of a manager with several
+			// entries still changes when any of them does
+			h := fnv.New64a()
+			h.Write(entry.FieldsV1.Raw)
+			owned.hash = owned.hash*31 + h.Sum64()
+
+			var tree map[string]interface{}
+			if withFields && json.Unmarshal(entry.FieldsV1.Raw, &tree) == nil {
+				flattenFields("", tree, owned.fields)
+			}
+		}
+		owners[entry.Manager] = owned
+	}
+	return owners
+}
+
+// flattenFields adds the leaf paths of a managedFields field set to fields
+func flattenFields(prefix string, tree map[string]interface{}, fields map[string]bool) {
+	for key, value := range tree {
+		if key == "." {
+			fields[prefix] = true
+			continue
+		}
+		p := fieldPath(prefix, key)
+		child, _ := value.(map[string]interface{})
+		if len(child) == 0 {
+			fields[p] = true
+			continue
+		}
+		flattenFields(p, child, fields)
+	}
+}
+
+// fieldPath appends a managedFields key to a field path. Field names
+// ("f:name") are joined with dots, list element keys ("k:{...}", "v:...",
+// "i:0") are put in brackets.
+func fieldPath(prefix, key string) string {
+	if name, ok := strings.CutPrefix(key, "f:"); ok {
+		return joinPath(prefix, name)
+	}
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		key = key[i+1:]
+	}
+	return prefix + "[" + key + "]"
+}
+
+// names returns the manager names in sorted order
+func (o ownership) names() []string {
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lastManager returns the manager with the most recent update
+func (o ownership) lastManager() string {
+	var last string
+	var latest time.Time
+	for _, name := range o.names() {
+		if last == "" || o[name].time.After(latest) {
+			last, latest = name, o[name].time
+		}
+	}
+	return last
+}
+
+// updater works out which manager turned previous into current: the most
+// recent manager whose update time advanced, otherwise a manager that gained
+// fields (or whose fields changed, when only hashes are kept), otherwise the
+// most recent manager overall. Update times only have second precision, so
+// repeated updates within a second need the fallbacks.
+func updater(previous, current ownership) string {
+	var manager string
+	var latest time.Time
+	for _, name := range current.names() {
+		owned := current[name]
+		if before, ok := previous[name]; ok && !owned.time.After(before.time) {
+			continue
+		}
+		if manager == "" || owned.time.After(latest) {
+			manager, latest = name, owned.time
+		}
+	}
+	if manager != "" {
+		return manager
+	}
+
+	for _, name := range current.names() {
+		if current[name].changedFrom(previous[name]) {
+			return name
+		}
+	}
+	return current.lastManager()
+}
+
+// changedFrom reports whether the manager gained fields since before, or
+// when the fields are not tracked, whether its field sets changed at all
+func (o ownedFields) changedFrom(before ownedFields) bool {
+	if o.fields == nil {
+		return o.hash != before.hash
+	}
+	return len(gainedFields(before.fields, o.fields)) > 0
+}
+
+// takeovers lists the fields manager gained in current that another manager
+// owned in previous and no longer owns, grouped by the previous owner
+func takeovers(manager string, previous, current ownership, t time.Time) []takeover {
+	gained := gainedFields(previous[manager].fields, current[manager].fields)
+	if len(gained) == 0 {
+		return nil
+	}
+
+	var result []takeover
+	for _, other := range previous.names() {
+		if other == manager {
+			continue
+		}
+		var fields []string
+		for _, field := range gained {
+			if previous[other].fields[field] && !current[other].fields[field] {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) > 0 {
+			result = append(result, takeover{time: t, from: other, to: manager, fields: fields})
+		}
+	}
+	return result
+}
+
+// gainedFields returns the fields in after but not in before, sorted
+func gainedFields(before, after map[string]bool) []string {
+	var gained []string
+	for field := range after {
+		if !before[field] {
+			gained = append(gained, field)
+		}
+	}
+	sort.Strings(gained)
+	return gained
+}
+
+// intersect returns the elements of the sorted slices a and b found in both
+func intersect(a, b []string) []string {
+	var result []string
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// increment returns a copy of counts with name counted once more. Counts are
+// copied rather than changed in place so copies handed out by GetResources
+// stay unchanged.
+func increment(counts map[string]int64, name string) map[string]int64 {
+	result := make(map[string]int64, len(counts)+1)
+	for k, v := range counts {
+		result[k] = v
+	}
+	result[name]++
+	return result
+}
+
+// activeFight returns the resource's fight if a takeover happened within
+// the fight window before now
+func (r *ResourceInfo) activeFight(now time.Time) *Fight {
+	if r.Fight == nil || now.Sub(r.Fight.Time) > fightWindow {
+		return nil
+	}
+	return r.Fight
+}
+
+// AggregateManagers sums the updates attributed to each field manager across
+// resources, ordered by updates (descending), then manager name
+func AggregateManagers(resources []*ResourceInfo) []ManagerStats {
+	byManager := make(map[string]*ManagerStats)
+	get := func(manager string) *ManagerStats {
+		stats, ok := byManager[manager]
+		if !ok {
+			stats = &ManagerStats{Manager: manager}
+			byManager[manager] = stats
+		}
+		return stats
+	}
+
+	for _, info := range resources {
+		for manager, updates := range info.Managers {
+			stats := get(manager)
+			stats.Updates += updates
+			stats.Resources++
+		}
+		if info.Fight != nil {
+			for _, manager := range info.Fight.Managers {
+				get(manager).Fights++
+			}
+		}
+	}
+
+	result := make([]ManagerStats, 0, len(byManager))
+	for _, stats := range byManager {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Updates != result[j].Updates {
+			return result[i].Updates > result[j].Updates
+		}
+		return result[i].Manager < result[j].Manager
+	})
+	return result
+}
@@ -0,0 +1,172 @@
+package kflap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// managed describes one managedFields entry: the manager, the time of its
+// last update in seconds and its field set
+type managed struct {
+	manager string
+	second  int
+	fields  string
+}
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// objectManagedBy returns an object with the given managedFields entries
+func objectManagedBy(entries ...managed) metav1.Object {
+	obj := &metav1.ObjectMeta{Name: "web"}
+	for _, e := range entries {
+		obj.ManagedFields = append(obj.ManagedFields, metav1.ManagedFieldsEntry{
+			Manager:  e.manager,
+			Time:     &metav1.Time{Time: epoch.Add(time.Duration(e.second) * time.Second)},
+			FieldsV1: &metav1.FieldsV1{Raw: []byte(e.fields)},
+		})
+	}
+	return obj
+}
+
+const (
+	replicasFields = `{"f:spec":{"f:replicas":{}}}`
+	templateFields = `{"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"web\"}":{".":{},"f:image":{}}}}}}}`
+	bothFields     = `{"f:spec":{"f:replicas":{},"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"web\"}":{".":{},"f:image":{}}}}}}}`
+)
+
+func TestUpdater(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous metav1.Object
+		current  metav1.Object
+		fields   bool
+		want     string
+	}{
+		{
+			name:     "update time advanced",
+			previous: objectManagedBy(managed{"argocd", 1, templateFields}, managed{"hpa", 2, replicasFields}),
+			current:  objectManagedBy(managed{"argocd", 5, templateFields}, managed{"hpa", 2, replicasFields}),
+			want:     "argocd",
+		},
+		{
+			name:     "new manager",
+			previous: objectManagedBy(managed{"argocd", 1, templateFields}),
+			current:  objectManagedBy(managed{"argocd", 1, templateFields}, managed{"kubectl", 1, replicasFields}),
+			want:     "kubectl",
+		},
+		{
+			name:     "same second, gained fields",
+			previous: objectManagedBy(managed{"argocd", 3, templateFields}, managed{"hpa", 3, replicasFields}),
+			current:  objectManagedBy(managed{"argocd", 3, bothFields}, managed{"hpa", 3, `{}`}),
+			fields:   true,
+			want:     "argocd",
+		},
+		{
+			name:     "same second, changed hash",
+			previous: objectManagedBy(managed{"argocd", 3, templateFields}, managed{"hpa", 3, replicasFields}),
+			current:  objectManagedBy(managed{"argocd", 3, bothFields}, managed{"hpa", 3, replicasFields}),
+			want:     "argocd",
+		},
+		{
+			name:     "nothing changed",
+			previous: objectManagedBy(managed{"argocd", 3, templateFields}, managed{"hpa", 4, replicasFields}),
+			current:  objectManagedBy(managed{"argocd", 3, templateFields}, managed{"hpa", 4, replicasFields}),
+			want:     "hpa",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := managedOwnership(tt.previous, tt.fields)
+			current := managedOwnership(tt.current, tt.fields)
+			if got := updater(previous, current); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTakeovers(t *testing.T) {
+	previous := managedOwnership(objectManagedBy(managed{"argocd", 1, templateFields}, managed{"hpa", 1, replicasFields}), true)
+	current := managedOwnership(objectManagedBy(managed{"argocd", 2, bothFields}), true)
+
+	got := takeovers("argocd", previous, current, epoch)
+	want := []takeover{{time: epoch, from: "hpa", to: "argocd", fields: []string{"spec.replicas"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got := takeovers("hpa", previous, current, epoch); got != nil {
+		t.Errorf("got takeovers %+v by a manager that gained nothing", got)
+	}
+}
+
+func TestRecordManagerFights(t *testing.T) {
+	// argocd and the HPA take spec.replicas from each other
+	states := []metav1.Object{
+		objectManagedBy(managed{"argocd", 0, templateFields}, managed{"hpa", 0, replicasFields}),
+		objectManagedBy(managed{"argocd", 60, bothFields}),
+		objectManagedBy(managed{"argocd", 60, templateFields}, managed{"hpa", 120, replicasFields}),
+	}
+
+	tests := []struct {
+		name      string
+		fights    bool
+		interval  time.Duration
+		wantFight *Fight
+	}{
+		{
+			name:     "fight",
+			fights:   true,
+			interval: time.Minute,
+			wantFight: &Fight{
+				Managers: []string{"argocd", "hpa"},
+				Fields:   []string{"spec.replicas"},
+			},
+		},
+		{
+			name:     "takeovers too far apart",
+			fights:   true,
+			interval: fightWindow + time.Minute,
+		},
+		{
+			name:     "fights not tracked",
+			fights:   false,
+			interval: time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Monitor{config: Config{Fights: tt.fights}, owners: make(map[string]ownership)}
+			info := &ResourceInfo{}
+			m.storeOwnership("web", info, states[0])
+			if info.Manager != "argocd" && info.Manager != "hpa" {
+				t.Fatalf("got initial manager %q", info.Manager)
+			}
+
+			var managers []string
+			for i, state := range states[1:] {
+				now := epoch.Add(time.Duration(i+1) * tt.interval)
+				managers = append(managers, m.recordManager("web", info, state, now))
+			}
+
+			if want := []string{"argocd", "hpa"}; !reflect.DeepEqual(managers, want) {
+				t.Errorf("got managers %v, want %v", managers, want)
+			}
+			if want := map[string]int64{"argocd": 1, "hpa": 1}; !reflect.DeepEqual(info.Managers, want) {
+				t.Errorf("got update counts %v, want %v", info.Managers, want)
+			}
+			if tt.wantFight != nil {
+				// The fight starts with the second takeover
+				tt.wantFight.Time = epoch.Add(2 * tt.interval)
+			}
+			if !reflect.DeepEqual(info.Fight, tt.wantFight) {
+				t.Errorf("got fight %+v, want %+v", info.Fight, tt.wantFight)
+			}
+		})
+	}
+}
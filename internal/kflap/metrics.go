@@ -0,0 +1,178 @@
+package kflap
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// resourceMetric is a metric written once per exported resource, optionally
+// split by an additional label
+type resourceMetric struct {
+	name        string
+	help        string
+	typ         string
+	label       string                          // Name of the additional label, if any
+	labelValues []string                        // Values of the additional label
+	values      func(r *ResourceInfo) []float64 // One value per label value, or a single value
+}
+
+var resourceMetrics = []resourceMetric{
+	{
+		name:   "kflap_resource_changes_total",
+		help:   "Observed resourceVersion changes of the resource.",
+		typ:    "counter",
+		values: func(r *ResourceInfo) []float64 { return []float64{float64(r.Changes)} },
+	},
+	{
+		name:        "kflap_resource_class_changes_total",
+		help:        "Observed changes of the resource by class: spec (generation bump), status, or metadata (labels and annotations).",
+		typ:         "counter",
+		label:       "class",
+		labelValues: []string{SortBySpec, SortByStatus, SortByMeta},
+		values: func(r *ResourceInfo) []float64 {
+			return []float64{float64(r.SpecChanges), float64(r.StatusChanges), float64(r.MetadataChanges)}
+		},
+	},
+	{
+		name:        "kflap_resource_change_rate",
+		help:        "Changes per minute of the resource over a sliding window.",
+		typ:         "gauge",
+		label:       "window",
+		labelValues: []string{SortBy1m, SortBy5m, SortBy15m},
+		values:      func(r *ResourceInfo) []float64 { return []float64{r.Rate1m, r.Rate5m, r.Rate15m} },
+	},
+	{
+		name:   "kflap_resource_oscillations_total",
+		help:   "Times the resource returned to a previously seen content state.",
+		typ:    "counter",
+		values: func(r *ResourceInfo) []float64 { return []float64{float64(r.Oscillations)} },
+	},
+	{
+		name:   "kflap_resource_flapping",
+		help:   "Whether the resource oscillated within the last 15 minutes.",
+		typ:    "gauge",
+		values: func(r *ResourceInfo) []float64 { return []float64{boolValue(r.Flapping)} },
+	},
+	{
+		name:   "kflap_resource_fighting",
+		help:   "Whether two field managers are taking the same fields of the resource from each other.",
+		typ:    "gauge",
+		values: func(r *ResourceInfo) []float64 { return []float64{boolValue(r.Fight != nil)} },
+	},
+}
+
+// seriesPerResource returns the number of series written for each exported
+// resource
+func seriesPerResource() int {
+	n := 0
+	for _, metric := range resourceMetrics {
+		n += max(len(metric.labelValues), 1)
+	}
+	return n
+}
+
+// exportedResources returns the changed resources to export: the top ones
+// by the configured sort key, limited to the configured number and to as
+// many as fit into the series cap
+func exportedResources(resources []*ResourceInfo, config Config) []*ResourceInfo {
+	changed := make([]*ResourceInfo, 0, len(resources))
+	for _, info := range resources {
+		if info.Changes > 0 {
+			changed = append(changed, info)
+		}
+	}
+
+	limit := config.Limit
+	if config.MaxSeries > 0 {
+		maxResources := config.MaxSeries / seriesPerResource()
+		if maxResources == 0 {
+			return nil
+		}
+		if limit == 0 || limit > maxResources {
+			limit = maxResources
+		}
+	}
+	return selectRows(changed, config.SortBy, config.HideStatusOnly, limit)
+}
+
+// writeMetrics writes the monitor's state in the Prometheus text exposition
+// format. Resources of several clusters carry a context label.
+func writeMetrics(w io.Writer, resources []*ResourceInfo, stats PollStats, clusters []ClusterStatus, config Config) error {
+	exported := exportedResources(resources, config)
+
+	var b strings.Builder
+	for _, metric := range resourceMetrics {
+		writeMetricHeader(&b, metric.name, metric.help, metric.typ)
+		for _, info := range exported {
+			labels := fmt.Sprintf(`group="%s",kind="%s",namespace="%s",name="%s"`,
+				escapeLabel(info.Group), escapeLabel(info.Type), escapeLabel(info.Namespace), escapeLabel(info.Name))
+			if info.Context != "" {
+				labels = fmt.Sprintf(`context="%s",%s`, escapeLabel(info.Context), labels)
+			}
+			values := metric.values(info)
+			if metric.label == "" {
+				writeSample(&b, metric.name, labels, values[0])
+				continue
+			}
+			for i, value := range values {
+				writeSample(&b, metric.name, fmt.Sprintf(`%s,%s="%s"`, labels, metric.label, metric.labelValues[i]), value)
+			}
+		}
+	}
+
+	for _, metric := range []struct {
+		name  string
+		help  string
+		typ   string
+		value float64
+	}{
+		{"kflap_resources_tracked", "Resources currently tracked by the monitor.", "gauge", float64(len(resources))},
+		{"kflap_resources_exported", "Resources exported after top-N and series limits.", "gauge", float64(len(exported))},
+		{"kflap_polls_total", "Polls of the cluster.", "counter", float64(stats.Polls)},
+		{"kflap_poll_errors_total", "Polls that failed as a whole.", "counter", float64(stats.PollErrors)},
+		{"kflap_request_errors_total", "Failed list or watch requests, which are skipped.", "counter", float64(stats.RequestErrors)},
+		{"kflap_poll_duration_seconds", "Duration of the most recent poll.", "gauge", stats.LastDuration.Seconds()},
+		{"kflap_lists_in_flight", "List requests currently being fetched.", "gauge", float64(stats.InFlight)},
+	} {
+		writeMetricHeader(&b, metric.name, metric.help, metric.typ)
+		writeSample(&b, metric.name, "", metric.value)
+	}
+
+	if len(clusters) > 0 {
+		writeMetricHeader(&b, "kflap_context_up", "Whether the most recent poll of the cluster succeeded.", "gauge")
+		for _, cluster := range clusters {
+			writeSample(&b, "kflap_context_up", fmt.Sprintf(`context="%s"`, escapeLabel(cluster.Context)), boolValue(cluster.Err == nil))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMetricHeader(b *strings.Builder, name, help, typ string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, typ)
+}
+
+func writeSample(b *strings.Builder, name, labels string, value float64) {
+	if labels != "" {
+		fmt.Fprintf(b, "%s{%s} %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+	} else {
+		fmt.Fprintf(b, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -3,39 +3,146 @@ package kflap
 import (
 	"context"
 	"fmt"
+	"io"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 // ResourceInfo holds information about a Kubernetes resource
 type ResourceInfo struct {
+	Context         string // Kubeconfig context of the cluster when monitoring several
 	Name            string
+	Group           string // API group of the resource type, empty for the core group
 	Type            string
 	Namespace       string
 	ResourceVersion int64
 	Changes         int64
+	SpecChanges     int64            // Changes that bumped metadata.generation, or the spec of objects without one
+	StatusChanges   int64            // Changes that left generation, labels, annotations and spec alone
+	MetadataChanges int64            // Changes to labels, annotations or other metadata only
+	Rate1m          float64          // Changes per minute over the last minute
+	Rate5m          float64          // Changes per minute over the last 5 minutes
+	Rate15m         float64          // Changes per minute over the last 15 minutes
+	Diffs           []Diff           // Most recent field-level diffs, newest first
+	Manager         string           // Field manager of the most recent update
+	Managers        map[string]int64 // Updates attributed to each field manager
+	Fight           *Fight           // Managers taking the same fields from each other, if any
+	Oscillations    int64            // Returns to a previously seen content state
+	Period          time.Duration    // Time taken by the most recent return to an earlier state
+	LastOscillation time.Time        // Time of the most recent oscillation
+	Flapping        bool             // Whether the resource oscillated recently
+	Alerts          []string         // Names of the alert rules firing on the resource
+	Highlight       bool             // Whether a firing rule asks for the resource to be highlighted
+
+	recentChanges []change       // Changes within the largest rate window
+	takeovers     []takeover     // Recent ownership transfers between managers
+	states        []contentState // Recent content states, oldest first
+	generation    int64          // Last seen metadata.generation
+	labelsHash    uint64         // Hash of the last seen labels and annotations
+	specHash      uint64         // Hash of the last seen full object without metadata and status
+	statusHash    uint64         // Hash of the last seen status of a full object
+}
+
+// PollStats describes the work a monitor has done so far
+type PollStats struct {
+	Polls         int64         // Completed polls, not counting calls skipped during another
+	PollErrors    int64         // Polls that failed as a whole
+	RequestErrors int64         // Failed list or watch requests, which are skipped
+	LastDuration  time.Duration // Duration of the most recent poll
+	InFlight      int64         // Lists currently being fetched
+	PeakInFlight  int64         // Most lists fetched at once during the current or most recent poll
 }
 
 // Monitor handles polling Kubernetes resources
 type Monitor struct {
-	config        Config
-	dynamicClient dynamic.Interface
-	clientset     *kubernetes.Clientset
-	resources     map[string]*ResourceInfo // key: namespace/type/name
-	mu            sync.RWMutex
+	config         Config
+	dynamicClient  dynamic.Interface
+	metadataClient metadata.Interface
+	clientset      *kubernetes.Clientset
+	filters        filters
+	resources      map[string]*ResourceInfo          // key: namespace/type/name
+	snapshots      map[string]map[string]interface{} // last seen object per key, for diffs
+	owners         map[string]ownership              // last seen field ownership per key
+	alerts         map[string]*alertState            // key: rule name and resource key
+	stats          PollStats
+	clock          func() time.Time // current time, the replay time when replaying
+	recorder       *recorder        // writes observed changes when recording
+	replay         *replayer        // feeds recorded changes instead of a cluster
+	context        string           // kubeconfig context, set on members of a multi-context monitor
+	setupErr       error            // error creating a member's clients, reported instead of polling
+	alertOut       io.Writer        // where alert output goes instead of stderr, if set
+	clusters       []*Monitor       // member monitors, one per context, when monitoring several
+	clusterErrs    []error          // error of each member's most recent poll
+	polling        atomic.Bool      // set while a call to Poll is running
+	inFlight       atomic.Int64     // lists currently being fetched
+	peakInFlight   atomic.Int64     // most lists fetched at once during the last poll
+	mu             sync.RWMutex
+
+	// Watch mode state
+	watchOnce sync.Once
+	watchErr  error
+	cancel    context.CancelFunc // stops the watches, guarded by mu
+	closed    bool               // set by Close so no watches start afterwards, guarded by mu
 }
 
 // NewMonitor creates a new resource monitor
 func NewMonitor(config Config) (*Monitor, error) {
+	if config.Replay != "" || len(config.AuditLogs) > 0 {
+		return newReplayMonitor(config)
+	}
+
+	// Diffs and oscillation detection compare complete objects, which
+	// metadata-only lists lack
+	if config.Diffs > 0 || config.Oscillation {
+		config.FullObjects = true
+	}
+
+	var rec *recorder
+	if config.Record != "" {
+		var err error
+		rec, err = openRecorder(config.Record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var m *Monitor
+	var err error
+	if config.multiCluster() {
+		m, err = newMultiMonitor(config, rec)
+	} else {
+		var context string
+		if len(config.Contexts) == 1 {
+			context = config.Contexts[0]
+		}
+		m, err = newClusterMonitor(config, context, rec)
+	}
+	if err != nil && rec != nil {
+		_ = rec.close()
+	}
+	return m, err
+}
+
+// newClusterMonitor creates a monitor for the cluster of a kubeconfig
+// context, the current one if empty
+func newClusterMonitor(config Config, context string, rec *recorder) (*Monitor, error) {
+	filters, err := newFilters(config)
+	if err != nil {
+		return nil, err
+	}
+
 	// Load kubeconfig
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	configOverrides := &clientcmd.ConfigOverrides{}
+	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: context}
 	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
 
 	restConfig, err := kubeConfig.ClientConfig()
@@ -43,12 +150,26 @@ func NewMonitor(config Config) (*Monitor, error) {
 		return nil, fmt.Errorf("error loading kubeconfig: %v", err)
 	}
 
+	// Client-side rate limiting, shared by all workers
+	if config.QPS > 0 {
+		restConfig.QPS = config.QPS
+	}
+	if config.Burst > 0 {
+		restConfig.Burst = config.Burst
+	}
+
 	// Create dynamic client for generic resource access
 	dynamicClient, err := dynamic.NewForConfig(restConfig)
 	if err != nil {
 		return nil, fmt.Errorf("error creating dynamic client: %v", err)
 	}
 
+	// Create metadata client for listing only object metadata
+	metadataClient, err := metadata.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating metadata client: %v", err)
+	}
+
 	// Create clientset for discovery
 	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
@@ -56,15 +177,80 @@ func NewMonitor(config Config) (*Monitor, error) {
 	}
 
 	return &Monitor{
-		config:        config,
-		dynamicClient: dynamicClient,
-		clientset:     clientset,
-		resources:     make(map[string]*ResourceInfo),
+		config:         config,
+		dynamicClient:  dynamicClient,
+		metadataClient: metadataClient,
+		clientset:      clientset,
+		filters:        filters,
+		resources:      make(map[string]*ResourceInfo),
+		snapshots:      make(map[string]map[string]interface{}),
+		owners:         make(map[string]ownership),
+		alerts:         make(map[string]*alertState),
+		clock:          time.Now,
+		recorder:       rec,
 	}, nil
 }
 
-// Poll fetches current resource versions and calculates deltas
+// now returns the current time, or the replay time when replaying
+func (m *Monitor) now() time.Time {
+	return m.clock()
+}
+
+// Poll fetches current resource versions and calculates deltas, then
+// evaluates the alert rules. In watch mode the watches are started on the
+// first call and keep the resource map up to date between calls. A call
+// made while another is still running returns at once without polling, so
+// lists of overlapping polls cannot be merged out of order.
 func (m *Monitor) Poll() error {
+	if !m.polling.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer m.polling.Store(false)
+
+	start := time.Now()
+
+	var err error
+	switch {
+	case m.replay != nil:
+		m.pollReplay()
+	case len(m.clusters) > 0:
+		err = m.pollClusters()
+	case m.config.Watch:
+		err = m.pollWatches()
+	default:
+		err = m.poll()
+	}
+
+	m.mu.Lock()
+	if m.recorder != nil {
+		if recordErr := m.recorder.flush(); recordErr != nil && err == nil {
+			err = fmt.Errorf("error writing recording: %v", recordErr)
+		}
+	}
+	m.stats.Polls++
+	m.stats.LastDuration = time.Since(start)
+	if err != nil {
+		m.stats.PollErrors++
+	}
+	alerts := m.evaluateRules(m.now())
+	m.mu.Unlock()
+
+	m.notify(alerts)
+	return err
+}
+
+// listJob is one list of a resource type in a namespace ("" for
+// cluster-scoped resources)
+type listJob struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+	kind      string
+}
+
+// poll lists every configured resource type and namespace once, fetching
+// in a bounded pool of workers. The lock is only taken to merge each page
+// of results, so readers are not blocked by slow lists.
+func (m *Monitor) poll() error {
 	ctx := context.Background()
 
 	// Discover API resources
@@ -77,19 +263,20 @@ func (m *Monitor) Poll() error {
 	namespaces := m.config.Namespaces
 	if len(namespaces) == 0 {
 		// Get all namespaces
-		nsList, err := m.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		listCtx, cancel := m.requestContext(ctx)
+		nsList, err := m.clientset.CoreV1().Namespaces().List(listCtx, metav1.ListOptions{})
+		cancel()
 		if err != nil {
 			return fmt.Errorf("error listing namespaces: %v", err)
 		}
 		for _, ns := range nsList.Items {
-			namespaces = append(namespaces, ns.Name)
+			if !m.filters.excludedNamespace(ns.Name) {
+				namespaces = append(namespaces, ns.Name)
+			}
 		}
 	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Poll each resource type
+	var jobs []listJob
 	for _, apiResource := range apiResources {
 		gvr := schema.GroupVersionResource{
 			Group:    apiResource.Group,
@@ -100,99 +287,255 @@ func (m *Monitor) Poll() error {
 		// Handle namespaced vs cluster-scoped resources
 		if apiResource.Namespaced {
 			for _, ns := range namespaces {
-				if err := m.pollNamespacedResource(ctx, gvr, ns, apiResource.Kind); err != nil {
-					// Log error but continue with other resources
-					continue
-				}
+				jobs = append(jobs, listJob{gvr: gvr, namespace: ns, kind: apiResource.Kind})
 			}
 		} else {
-			if err := m.pollClusterResource(ctx, gvr, apiResource.Kind); err != nil {
-				// Log error but continue with other resources
-				continue
-			}
+			jobs = append(jobs, listJob{gvr: gvr, kind: apiResource.Kind})
 		}
 	}
 
+	m.peakInFlight.Store(0)
+	queue := make(chan listJob)
+	var wg sync.WaitGroup
+	for range max(m.config.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				m.runListJob(ctx, job)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
 	return nil
 }
 
-func (m *Monitor) pollNamespacedResource(ctx context.Context, gvr schema.GroupVersionResource, namespace, kind string) error {
-	list, err := m.dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return err
+// runListJob lists one resource type in one namespace and merges the
+// results page by page
+func (m *Monitor) runListJob(ctx context.Context, job listJob) {
+	inFlight := m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+	for peak := m.peakInFlight.Load(); inFlight > peak && !m.peakInFlight.CompareAndSwap(peak, inFlight); {
+		peak = m.peakInFlight.Load()
 	}
 
-	for _, item := range list.Items {
-		m.updateResourceInfo(item.GetName(), kind, namespace, item.GetResourceVersion())
+	err := m.listObjects(ctx, job.gvr, job.namespace, func(objs []metav1.Object) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for _, obj := range objs {
+			m.updateResourceInfo(job.gvr, job.kind, obj)
+		}
+	})
+	if err != nil {
+		// Count error but continue with other resources
+		m.mu.Lock()
+		m.stats.RequestErrors++
+		m.mu.Unlock()
 	}
+}
 
-	return nil
+// requestContext bounds a single request by the configured timeout, if any
+func (m *Monitor) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.config.RequestTimeout > 0 {
+		return context.WithTimeout(ctx, m.config.RequestTimeout)
+	}
+	return context.WithCancel(ctx)
 }
 
-func (m *Monitor) pollClusterResource(ctx context.Context, gvr schema.GroupVersionResource, kind string) error {
-	list, err := m.dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return err
+// listObjects lists gvr in namespace ("" for cluster-scoped resources) one
+// page at a time and calls fn with the objects of each page. Only object
+// metadata is fetched unless full objects are configured. The request
+// timeout applies to each page.
+func (m *Monitor) listObjects(ctx context.Context, gvr schema.GroupVersionResource, namespace string, fn func([]metav1.Object)) error {
+	opts := m.listOptions()
+	opts.Limit = m.config.PageSize
+	for {
+		continueToken, err := m.listPage(ctx, gvr, namespace, opts, fn)
+		if err != nil {
+			return err
+		}
+		if continueToken == "" {
+			return nil
+		}
+		opts.Continue = continueToken
 	}
+}
+
+// listPage fetches one page of a list and returns its continue token
+func (m *Monitor) listPage(ctx context.Context, gvr schema.GroupVersionResource, namespace string, opts metav1.ListOptions, fn func([]metav1.Object)) (string, error) {
+	ctx, cancel := m.requestContext(ctx)
+	defer cancel()
 
-	for _, item := range list.Items {
-		m.updateResourceInfo(item.GetName(), kind, "", item.GetResourceVersion())
+	if m.config.FullObjects {
+		list, err := m.dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		objs := make([]metav1.Object, len(list.Items))
+		for i := range list.Items {
+			objs[i] = &list.Items[i]
+		}
+		fn(objs)
+		return list.GetContinue(), nil
 	}
 
-	return nil
+	list, err := m.metadataClient.Resource(gvr).Namespace(namespace).List(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+	objs := make([]metav1.Object, len(list.Items))
+	for i := range list.Items {
+		objs[i] = &list.Items[i]
+	}
+	fn(objs)
+	return list.Continue, nil
 }
 
-func (m *Monitor) updateResourceInfo(name, resourceType, namespace, versionStr string) {
-	key := fmt.Sprintf("%s/%s/%s", namespace, resourceType, name)
+func (m *Monitor) updateResourceInfo(gvr schema.GroupVersionResource, resourceType string, obj metav1.Object) {
+	name, namespace := obj.GetName(), obj.GetNamespace()
+	if m.filters.excludedNamespace(namespace) {
+		// Watches across all namespaces deliver excluded ones too
+		return
+	}
+	key := resourceKey(namespace, resourceType, name)
 
-	version, err := strconv.ParseInt(versionStr, 10, 64)
+	version, err := strconv.ParseInt(obj.GetResourceVersion(), 10, 64)
 	if err != nil {
 		return
 	}
 
-	if existing, ok := m.resources[key]; ok {
-		changes := existing.Changes
-		if version != existing.ResourceVersion {
-			changes++
-		}
-		m.resources[key] = &ResourceInfo{
-			Name:            name,
-			Type:            resourceType,
-			Namespace:       namespace,
-			ResourceVersion: version,
-			Changes:         changes,
-		}
-	} else {
+	existing, ok := m.resources[key]
+	if !ok {
 		// First time seeing this resource
-		m.resources[key] = &ResourceInfo{
+		info := &ResourceInfo{
+			Context:         m.context,
 			Name:            name,
+			Group:           gvr.Group,
 			Type:            resourceType,
 			Namespace:       namespace,
 			ResourceVersion: version,
 		}
+		observeClassifiers(info, obj)
+		m.resources[key] = info
+		m.storeSnapshot(key, obj)
+		m.storeOwnership(key, info, obj)
+		m.recordState(info, obj, m.now())
+		return
+	}
+
+	// Older versions come from lists that started before the one already
+	// merged and are not changes
+	if version > existing.ResourceVersion {
+		now := m.now()
+		oscillations, fight := existing.Oscillations, existing.Fight
+		existing.Changes++
+		existing.ResourceVersion = version
+		class := classifyChange(existing, obj)
+		existing.recordChange(now, class)
+		diff := m.recordDiff(key, gvr, existing, obj, now)
+		manager := m.recordManager(key, existing, obj, now)
+		m.recordState(existing, obj, now)
+
+		if m.recorder != nil {
+			change := recordedChange{
+				Time:            now,
+				Context:         m.context,
+				Group:           gvr.Group,
+				Version:         gvr.Version,
+				Resource:        gvr.Resource,
+				Kind:            resourceType,
+				Namespace:       namespace,
+				Name:            name,
+				ResourceVersion: version,
+				Class:           class,
+				Manager:         manager,
+			}
+			if existing.Oscillations != oscillations {
+				change.Period = existing.Period
+			}
+			if existing.Fight != fight {
+				change.Fight = existing.Fight
+			}
+			if diff != nil {
+				change.Diff = diff.Changes
+			}
+			m.recorder.write(change)
+		}
 	}
 }
 
+func resourceKey(namespace, resourceType, name string) string {
+	return fmt.Sprintf("%s/%s/%s", namespace, resourceType, name)
+}
+
+// Key returns the identifier of the resource in the monitor, prefixed with
+// the context when monitoring several clusters
+func (r *ResourceInfo) Key() string {
+	if r.Context != "" {
+		return r.Context + "/" + resourceKey(r.Namespace, r.Type, r.Name)
+	}
+	return resourceKey(r.Namespace, r.Type, r.Name)
+}
+
 // GetResources returns a copy of current resource information
 func (m *Monitor) GetResources() []*ResourceInfo {
+	if len(m.clusters) > 0 {
+		var result []*ResourceInfo
+		for _, cluster := range m.clusters {
+			result = append(result, cluster.GetResources()...)
+		}
+		return result
+	}
+
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	now := m.now()
 	result := make([]*ResourceInfo, 0, len(m.resources))
 	for _, info := range m.resources {
 		// Create a copy
 		infoCopy := *info
+		infoCopy.computeRates(now)
+		infoCopy.Fight = info.activeFight(now)
+		infoCopy.Flapping = info.flapping(now)
+		infoCopy.recentChanges = nil
+		infoCopy.takeovers = nil
+		infoCopy.states = nil
 		result = append(result, &infoCopy)
 	}
 	return result
 }
 
+// Stats returns a copy of the monitor's poll statistics, including the
+// request errors and lists of all clusters when monitoring several
+func (m *Monitor) Stats() PollStats {
+	m.mu.RLock()
+	stats := m.stats
+	m.mu.RUnlock()
+	stats.InFlight = m.inFlight.Load()
+	stats.PeakInFlight = m.peakInFlight.Load()
+
+	for _, cluster := range m.clusters {
+		clusterStats := cluster.Stats()
+		stats.RequestErrors += clusterStats.RequestErrors
+		stats.InFlight += clusterStats.InFlight
+		stats.PeakInFlight += clusterStats.PeakInFlight
+	}
+	return stats
+}
+
 type apiResourceInfo struct {
 	Group      string
 	Version    string
 	Name       string
 	Kind       string
 	Namespaced bool
+	Verbs      metav1.Verbs
 }
 
 func (m *Monitor) discoverResources() ([]apiResourceInfo, error) {
@@ -251,13 +594,18 @@ func (m *Monitor) discoverResources() ([]apiResourceInfo, error) {
 				}
 			}
 
-			result = append(result, apiResourceInfo{
+			info := apiResourceInfo{
 				Group:      gv.Group,
 				Version:    gv.Version,
 				Name:       apiResource.Name,
 				Kind:       apiResource.Kind,
 				Namespaced: apiResource.Namespaced,
-			})
+				Verbs:      apiResource.Verbs,
+			}
+			if m.filters.excludedResource(info) {
+				continue
+			}
+			result = append(result, info)
 		}
 	}
 
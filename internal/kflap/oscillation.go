@@ -0,0 +1,89 @@
+package kflap
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// flappingWindow is how long a resource is flagged as flapping after it last
+// returned to a previously seen state
+const flappingWindow = 15 * time.Minute
+
+// maxStates bounds the content states remembered per resource
+const maxStates = 32
+
+// contentState is a hash of an object's content and when it was first seen
+type contentState struct {
+	hash uint64
+	time time.Time
+}
+
+// recordState hashes the content of obj and, when it differs from the last
+// state, checks whether the resource returned to an earlier state. A return
+// counts as an oscillation with a period of the time since that state was
+// seen. Steady churn such as a Lease renewing produces new states only and
+// is never counted.
+func (m *Monitor) recordState(info *ResourceInfo, obj metav1.Object, t time.Time) {
+	if !m.config.Oscillation {
+		return
+	}
+	hash, ok := m.contentHash(obj)
+	if !ok {
+		return
+	}
+
+	if n := len(info.states); n > 0 {
+		if info.states[n-1].hash == hash {
+			return
+		}
+		for i := n - 2; i >= 0; i-- {
+			if info.states[i].hash == hash {
+				info.Oscillations++
+				info.Period = t.Sub(info.states[i].time)
+				info.LastOscillation = t
+				break
+			}
+		}
+	}
+
+	info.states = append(info.states, contentState{hash: hash, time: t})
+	if len(info.states) > maxStates {
+		info.states = info.states[len(info.states)-maxStates:]
+	}
+}
+
+// contentHash hashes everything but the metadata of a full object, and the
+// status too unless it is configured to be included
+func (m *Monitor) contentHash(obj metav1.Object) (uint64, bool) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return 0, false
+	}
+
+	content := make(map[string]interface{}, len(u.Object))
+	for k, v := range u.Object {
+		if k == "metadata" || (k == "status" && !m.config.HashStatus) {
+			continue
+		}
+		content[k] = v
+	}
+
+	// Maps are encoded with sorted keys, so equal content hashes equally
+	data, err := json.Marshal(content)
+	if err != nil {
+		return 0, false
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return h.Sum64(), true
+}
+
+// flapping reports whether the resource oscillated within the flapping
+// window before now
+func (r *ResourceInfo) flapping(now time.Time) bool {
+	return r.Oscillations > 0 && now.Sub(r.LastOscillation) <= flappingWindow
+}
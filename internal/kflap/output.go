@@ -0,0 +1,301 @@
+package kflap
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats accepted by Config.Output
+const (
+	OutputJSON   = "json"
+	OutputNDJSON = "ndjson"
+	OutputCSV    = "csv"
+	OutputTable  = "table"
+)
+
+// OutputFormats lists the valid headless output formats
+var OutputFormats = []string{OutputJSON, OutputNDJSON, OutputCSV, OutputTable}
+
+// ValidateOutput returns an error if format is not one of OutputFormats
+func ValidateOutput(format string) error {
+	for _, f := range OutputFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid output format '%s' (want one of %v)", format, OutputFormats)
+}
+
+// resourceRecord is the machine-readable form of a ResourceInfo
+type resourceRecord struct {
+	Time            time.Time        `json:"time"`
+	Context         string           `json:"context,omitempty"`
+	Namespace       string           `json:"namespace,omitempty"`
+	Type            string           `json:"type"`
+	Name            string           `json:"name"`
+	ResourceVersion int64            `json:"resourceVersion"`
+	Changes         int64            `json:"changes"`
+	SpecChanges     int64            `json:"specChanges"`
+	StatusChanges   int64            `json:"statusChanges"`
+	MetadataChanges int64            `json:"metadataChanges"`
+	Rate1m          float64          `json:"rate1m"`
+	Rate5m          float64          `json:"rate5m"`
+	Rate15m         float64          `json:"rate15m"`
+	Oscillations    int64            `json:"oscillations"`
+	PeriodSeconds   float64          `json:"periodSeconds,omitempty"`
+	Flapping        bool             `json:"flapping"`
+	Manager         string           `json:"manager,omitempty"`
+	Managers        map[string]int64 `json:"managers,omitempty"`
+	Fight           *Fight           `json:"fight,omitempty"`
+	Alerts          []string         `json:"alerts,omitempty"`
+	Diffs           []Diff           `json:"diffs,omitempty"`
+}
+
+func newResourceRecord(t time.Time, info *ResourceInfo) resourceRecord {
+	return resourceRecord{
+		Time:            t,
+		Context:         info.Context,
+		Namespace:       info.Namespace,
+		Type:            info.Type,
+		Name:            info.Name,
+		ResourceVersion: info.ResourceVersion,
+		Changes:         info.Changes,
+		SpecChanges:     info.SpecChanges,
+		StatusChanges:   info.StatusChanges,
+		MetadataChanges: info.MetadataChanges,
+		Rate1m:          info.Rate1m,
+		Rate5m:          info.Rate5m,
+		Rate15m:         info.Rate15m,
+		Oscillations:    info.Oscillations,
+		PeriodSeconds:   info.Period.Seconds(),
+		Flapping:        info.Flapping,
+		Manager:         info.Manager,
+		Managers:        info.Managers,
+		Fight:           info.Fight,
+		Alerts:          info.Alerts,
+		Diffs:           info.Diffs,
+	}
+}
+
+// RunHeadless polls without a TUI and writes snapshots of the resources to
+// w in the configured output format: after every poll, or once when the
+// configured duration has elapsed. It runs until interrupted unless a
+// duration is set or a replay finishes; an interrupt during a timed run
+// writes the snapshot early.
+func RunHeadless(config Config, w io.Writer) error {
+	if config.Interval < 1 {
+		return fmt.Errorf("interval must be at least 1 second")
+	}
+
+	monitor, err := NewMonitor(config)
+	if err != nil {
+		return err
+	}
+	defer monitor.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var deadline <-chan time.Time
+	if config.Duration > 0 {
+		timer := time.NewTimer(config.Duration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	out := &snapshotWriter{w: w, format: config.Output}
+	ticker := time.NewTicker(time.Duration(config.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := monitor.Poll(); err != nil {
+			return err
+		}
+		reportClusterErrors(monitor)
+
+		// A finished replay has nothing left to wait for
+		_, _, _, finished := monitor.ReplayProgress()
+		if config.Duration == 0 || finished {
+			if err := out.write(monitor.now(), monitor.GetResources(), config); err != nil {
+				return err
+			}
+		}
+		if finished {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			if err := monitor.Poll(); err != nil {
+				return err
+			}
+			reportClusterErrors(monitor)
+			return out.write(monitor.now(), monitor.GetResources(), config)
+		case <-ctx.Done():
+			if config.Duration > 0 {
+				return out.write(monitor.now(), monitor.GetResources(), config)
+			}
+			return nil
+		}
+	}
+}
+
+// reportClusterErrors prints the errors of the clusters whose last poll
+// failed while others succeeded
+func reportClusterErrors(monitor *Monitor) {
+	for _, cluster := range monitor.Clusters() {
+		if cluster.Err != nil {
+			fmt.Fprintf(os.Stderr, "Error: context %s: %v\n", cluster.Context, cluster.Err)
+		}
+	}
+}
+
+// snapshotWriter writes snapshots in one output format, remembering whether
+// the CSV header was written already
+type snapshotWriter struct {
+	w           io.Writer
+	format      string
+	wroteHeader bool
+}
+
+func (s *snapshotWriter) write(t time.Time, resources []*ResourceInfo, config Config) error {
+	rows := selectRows(resources, config.SortBy, config.HideStatusOnly, config.Limit)
+	if s.format == OutputTable {
+		return s.writeTable(t, rows, config.multiCluster())
+	}
+
+	records := make([]resourceRecord, len(rows))
+	for i, info := range rows {
+		records[i] = newResourceRecord(t, info)
+	}
+
+	switch s.format {
+	case OutputJSON:
+		return s.writeJSON(t, records)
+	case OutputNDJSON:
+		return s.writeNDJSON(records)
+	default:
+		return s.writeCSV(records, config.multiCluster())
+	}
+}
+
+// writeJSON writes the snapshot as one indented JSON document
+func (s *snapshotWriter) writeJSON(t time.Time, records []resourceRecord) error {
+	encoder := json.NewEncoder(s.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Time      time.Time        `json:"time"`
+		Resources []resourceRecord `json:"resources"`
+	}{t, records})
+}
+
+// writeNDJSON writes one JSON object per resource and line
+func (s *snapshotWriter) writeNDJSON(records []resourceRecord) error {
+	encoder := json.NewEncoder(s.w)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV writes one row per resource, with a header before the first
+// snapshot only so consecutive snapshots form a single CSV file. A context
+// column follows the time when monitoring several clusters.
+func (s *snapshotWriter) writeCSV(records []resourceRecord, withContext bool) error {
+	cw := csv.NewWriter(s.w)
+	if !s.wroteHeader {
+		s.wroteHeader = true
+		if err := cw.Write(withContextColumn(withContext, "context", []string{
+			"time", "namespace", "type", "name", "resource_version",
+			"changes", "spec_changes", "status_changes", "metadata_changes",
+			"rate_1m", "rate_5m", "rate_15m",
+			"oscillations", "period_seconds", "flapping", "manager", "fight",
+		})); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range records {
+		var fight string
+		if r.Fight != nil {
+			fight = strings.Join(r.Fight.Managers, " vs ")
+		}
+		if err := cw.Write(withContextColumn(withContext, r.Context, []string{
+			r.Time.Format(time.RFC3339),
+			r.Namespace,
+			r.Type,
+			r.Name,
+			strconv.FormatInt(r.ResourceVersion, 10),
+			strconv.FormatInt(r.Changes, 10),
+			strconv.FormatInt(r.SpecChanges, 10),
+			strconv.FormatInt(r.StatusChanges, 10),
+			strconv.FormatInt(r.MetadataChanges, 10),
+			strconv.FormatFloat(r.Rate1m, 'f', -1, 64),
+			strconv.FormatFloat(r.Rate5m, 'f', -1, 64),
+			strconv.FormatFloat(r.Rate15m, 'f', -1, 64),
+			strconv.FormatInt(r.Oscillations, 10),
+			strconv.FormatFloat(r.PeriodSeconds, 'f', -1, 64),
+			strconv.FormatBool(r.Flapping),
+			r.Manager,
+			fight,
+		})); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeTable writes a plain text table preceded by the snapshot time
+func (s *snapshotWriter) writeTable(t time.Time, rows []*ResourceInfo, withContext bool) error {
+	tw := tabwriter.NewWriter(s.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "# %s\n", t.Format(time.RFC3339))
+	if withContext {
+		fmt.Fprint(tw, "CONTEXT\t")
+	}
+	fmt.Fprintln(tw, "NAMESPACE\tTYPE\tNAME\tCHANGES\tSPEC\tSTATUS\tMETA\tRATE 1M\tRATE 5M\tRATE 15M\tOSCILLATION\tMANAGER")
+	for _, info := range rows {
+		namespace := info.Namespace
+		if namespace == "" {
+			namespace = "<cluster>"
+		}
+		manager := info.Manager
+		if info.Fight != nil {
+			manager = strings.Join(info.Fight.Managers, " vs ")
+		}
+		if withContext {
+			fmt.Fprintf(tw, "%s\t", info.Context)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			namespace, info.Type, info.Name,
+			info.Changes, info.SpecChanges, info.StatusChanges, info.MetadataChanges,
+			formatRate(info.Rate1m), formatRate(info.Rate5m), formatRate(info.Rate15m),
+			orAbsent(formatOscillation(info)), orAbsent(manager),
+		)
+	}
+	fmt.Fprintln(tw)
+	return tw.Flush()
+}
+
+// withContextColumn inserts the context column after the time column of a
+// CSV row if wanted
+func withContextColumn(wanted bool, context string, row []string) []string {
+	if !wanted {
+		return row
+	}
+	return append([]string{row[0], context}, row[1:]...)
+}
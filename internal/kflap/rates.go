@@ -0,0 +1,101 @@
+package kflap
+
+import (
+	"fmt"
+	"time"
+)
+
+// rateWindows are the sliding windows change rates are computed over
+var rateWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// Sort keys accepted by Config.SortBy
+const (
+	SortByChanges = "changes"
+	SortBy1m      = "1m"
+	SortBy5m      = "5m"
+	SortBy15m     = "15m"
+	SortBySpec    = "spec"
+	SortByStatus  = "status"
+	SortByMeta    = "metadata"
+)
+
+// SortKeys lists the valid sort keys in the order the TUI cycles through them
+var SortKeys = []string{SortByChanges, SortBy1m, SortBy5m, SortBy15m, SortBySpec, SortByStatus, SortByMeta}
+
+// ValidateSortKey returns an error if key is not one of SortKeys
+func ValidateSortKey(key string) error {
+	for _, k := range SortKeys {
+		if k == key {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid sort key '%s' (want one of %v)", key, SortKeys)
+}
+
+// change is a change observed at a time, with its class: spec, status or
+// metadata
+type change struct {
+	time  time.Time
+	class string
+}
+
+// recordChange notes a change of class observed at t and forgets changes
+// that fall outside the largest rate window
+func (r *ResourceInfo) recordChange(t time.Time, class string) {
+	r.recentChanges = append(r.recentChanges, change{time: t, class: class})
+
+	cutoff := t.Add(-maxWindow())
+	i := 0
+	for i < len(r.recentChanges) && !r.recentChanges[i].time.After(cutoff) {
+		i++
+	}
+	r.recentChanges = r.recentChanges[i:]
+}
+
+// changesWithin counts the changes of class ("" for any class) within
+// window before now
+func (r *ResourceInfo) changesWithin(now time.Time, window time.Duration, class string) int {
+	cutoff := now.Add(-window)
+	count := 0
+	for _, c := range r.recentChanges {
+		if c.time.After(cutoff) && (class == "" || c.class == class) {
+			count++
+		}
+	}
+	return count
+}
+
+// computeRates sets the per-minute change rates for each window ending at now
+func (r *ResourceInfo) computeRates(now time.Time) {
+	rates := make([]float64, len(rateWindows))
+	for i, window := range rateWindows {
+		rates[i] = float64(r.changesWithin(now, window, "")) / window.Minutes()
+	}
+	r.Rate1m, r.Rate5m, r.Rate15m = rates[0], rates[1], rates[2]
+}
+
+// maxWindow returns the largest rate window, which bounds how long changes
+// are remembered
+func maxWindow() time.Duration {
+	return rateWindows[len(rateWindows)-1]
+}
+
+// sortValue returns the value resources are ranked by for key
+func (r *ResourceInfo) sortValue(key string) float64 {
+	switch key {
+	case SortBy1m:
+		return r.Rate1m
+	case SortBy5m:
+		return r.Rate5m
+	case SortBy15m:
+		return r.Rate15m
+	case SortBySpec:
+		return float64(r.SpecChanges)
+	case SortByStatus:
+		return float64(r.StatusChanges)
+	case SortByMeta:
+		return float64(r.MetadataChanges)
+	default:
+		return float64(r.Changes)
+	}
+}
@@ -0,0 +1,85 @@
+package kflap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// recordedChange is one line of a recording: a single observed change with
+// what the monitor derived from it. Keys are kept short as recordings of
+// busy clusters grow quickly.
+type recordedChange struct {
+	Time            time.Time     `json:"t"`
+	Context         string        `json:"ctx,omitempty"` // Set when monitoring several clusters
+	Group           string        `json:"g,omitempty"`
+	Version         string        `json:"v"`
+	Resource        string        `json:"r"`
+	Kind            string        `json:"k"`
+	Namespace       string        `json:"ns,omitempty"`
+	Name            string        `json:"n"`
+	ResourceVersion int64         `json:"rv"`
+	Class           string        `json:"c"`
+	Manager         string        `json:"m,omitempty"`
+	Period          time.Duration `json:"osc,omitempty"`   // Set when the change returned to an earlier state
+	Fight           *Fight        `json:"fight,omitempty"` // Set when the change started or continued a fight
+	Diff            []FieldChange `json:"d,omitempty"`     // Set when diffs are recorded
+}
+
+// recorder appends changes to a recording as JSON lines. The members of a
+// multi-context monitor share one recorder.
+type recorder struct {
+	file *os.File
+	w    *bufio.Writer
+	err  error // First write error, reported by flush
+	mu   sync.Mutex
+}
+
+// openRecorder opens a recording for appending, creating it readable by its
+// owner only as it can hold diffs of cluster objects
+func openRecorder(filename string) (*recorder, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening recording: %v", err)
+	}
+	return &recorder{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+func (r *recorder) write(change recordedChange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	data, err := json.Marshal(change)
+	if err != nil {
+		r.err = err
+		return
+	}
+	if _, err := r.w.Write(append(data, '\n')); err != nil {
+		r.err = err
+	}
+}
+
+// flush writes buffered changes to the file and returns the first error
+// since the recording was opened
+func (r *recorder) flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.err = r.w.Flush()
+	return r.err
+}
+
+func (r *recorder) close() error {
+	err := r.flush()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
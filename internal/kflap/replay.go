@@ -0,0 +1,180 @@
+package kflap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// maxRecordedLine bounds a single line of a recording, which can be large
+// when it carries a diff
+const maxRecordedLine = 16 * 1024 * 1024
+
+// replayer feeds the changes of a recording to a monitor at the pace they
+// were recorded, sped up by a factor, or all at once when the factor is 0
+type replayer struct {
+	changes []recordedChange
+	next    int       // Index of the first change not applied yet
+	start   time.Time // Wall-clock time the replay started
+	speed   float64
+}
+
+// newReplayMonitor creates a monitor that replays the configured recording
+// or audit logs instead of talking to a cluster
+func newReplayMonitor(config Config) (*Monitor, error) {
+	var changes []recordedChange
+	var err error
+	if len(config.AuditLogs) > 0 {
+		changes, err = loadAuditLogs(config.AuditLogs)
+		if err == nil && len(changes) == 0 {
+			err = fmt.Errorf("audit logs contain no successful updates")
+		}
+	} else {
+		changes, err = loadRecording(config.Replay)
+		if err == nil && len(changes) == 0 {
+			err = fmt.Errorf("recording %s contains no changes", config.Replay)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Recordings appended to by several sessions and rotated audit logs
+	// may overlap
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Time.Before(changes[j].Time)
+	})
+
+	replay := &replayer{changes: changes, start: time.Now(), speed: max(config.Speed, 0)}
+
+	return &Monitor{
+		config:    config,
+		resources: make(map[string]*ResourceInfo),
+		snapshots: make(map[string]map[string]interface{}),
+		owners:    make(map[string]ownership),
+		alerts:    make(map[string]*alertState),
+		clock:     replay.now,
+		replay:    replay,
+	}, nil
+}
+
+// loadRecording reads all changes of a recording
+func loadRecording(filename string) ([]recordedChange, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening recording: %v", err)
+	}
+	defer file.Close()
+
+	var changes []recordedChange
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordedLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var change recordedChange
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+			return nil, fmt.Errorf("error parsing recording line %d: %v", line, err)
+		}
+		changes = append(changes, change)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading recording: %v", err)
+	}
+	return changes, nil
+}
+
+// now returns the replay time: the time of the first change plus the
+// wall-clock time since the replay started times the speed, stopping at
+// the last change, which is where an instant replay starts
+func (r *replayer) now() time.Time {
+	first, last := r.changes[0].Time, r.changes[len(r.changes)-1].Time
+	if r.speed == 0 {
+		return last
+	}
+	t := first.Add(time.Duration(float64(time.Since(r.start)) * r.speed))
+	if t.After(last) {
+		return last
+	}
+	return t
+}
+
+// pollReplay applies the recorded changes up to the current replay time
+func (m *Monitor) pollReplay() {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := m.replay
+	for r.next < len(r.changes) && !r.changes[r.next].Time.After(now) {
+		m.applyRecordedChange(r.changes[r.next])
+		r.next++
+	}
+}
+
+// applyRecordedChange updates the resource map as if the change had just
+// been observed
+func (m *Monitor) applyRecordedChange(change recordedChange) {
+	key := resourceKey(change.Namespace, change.Kind, change.Name)
+	if change.Context != "" {
+		key = change.Context + "/" + key
+	}
+	info, ok := m.resources[key]
+	if !ok {
+		info = &ResourceInfo{
+			Context:   change.Context,
+			Name:      change.Name,
+			Group:     change.Group,
+			Type:      change.Kind,
+			Namespace: change.Namespace,
+		}
+		m.resources[key] = info
+	}
+
+	info.Changes++
+	info.ResourceVersion = change.ResourceVersion
+	switch change.Class {
+	case classSpec:
+		info.SpecChanges++
+	case classStatus:
+		info.StatusChanges++
+	case classMetadata:
+		info.MetadataChanges++
+	}
+	info.recordChange(change.Time, change.Class)
+
+	if change.Manager != "" {
+		info.Manager = change.Manager
+		info.Managers = increment(info.Managers, change.Manager)
+	}
+	if change.Fight != nil {
+		info.Fight = change.Fight
+	}
+	if change.Period > 0 {
+		info.Oscillations++
+		info.Period = change.Period
+		info.LastOscillation = change.Time
+	}
+	if change.Diff != nil && m.config.Diffs > 0 {
+		m.addDiff(info, Diff{Time: change.Time, ResourceVersion: change.ResourceVersion, Changes: change.Diff})
+	}
+}
+
+// ReplayProgress reports the times of the first and last recorded change,
+// the replay time reached and whether all changes were applied. It returns
+// zero values when the monitor is not replaying.
+func (m *Monitor) ReplayProgress() (start, current, end time.Time, done bool) {
+	if m.replay == nil {
+		return time.Time{}, time.Time{}, time.Time{}, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	r := m.replay
+	return r.changes[0].Time, m.now(), r.changes[len(r.changes)-1].Time, r.next == len(r.changes)
+}
@@ -0,0 +1,76 @@
+package kflap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Serve runs the monitor continuously and serves its state as Prometheus
+// metrics on /metrics at the configured listen address until interrupted
+func Serve(config Config) error {
+	if config.Interval < 1 {
+		return fmt.Errorf("interval must be at least 1 second")
+	}
+
+	monitor, err := NewMonitor(config)
+	if err != nil {
+		return err
+	}
+	defer monitor.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			// Failed polls are counted in the exported statistics too
+			if err := monitor.Poll(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			} else {
+				reportClusterErrors(monitor)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = writeMetrics(w, monitor.GetResources(), monitor.Stats(), monitor.Clusters(), config)
+	})
+	server := &http.Server{
+		Addr:              config.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	fmt.Fprintf(os.Stderr, "Serving metrics on %s/metrics\n", config.Listen)
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("error serving metrics: %v", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("error shutting down metrics server: %v", err)
+		}
+		return nil
+	}
+}
@@ -13,42 +13,64 @@ import (
 // Styles
 var (
 	headerStyle = lipgloss.NewStyle().
-		Bold(true).
-		Foreground(lipgloss.Color("12")).
-		BorderStyle(lipgloss.NormalBorder()).
-		BorderBottom(true)
+			Bold(true).
+			Foreground(lipgloss.Color("12")).
+			BorderStyle(lipgloss.NormalBorder()).
+			BorderBottom(true)
 
 	changesStyle = lipgloss.NewStyle().
-		Bold(true).
-		Foreground(lipgloss.Color("9")) // Red
+			Bold(true).
+			Foreground(lipgloss.Color("9")) // Red
+
+	alertStyle = lipgloss.NewStyle().
+			Reverse(true).
+			Foreground(lipgloss.Color("9")) // Red
 
 	cellStyle = lipgloss.NewStyle().
-		PaddingRight(2)
+			PaddingRight(2)
 )
 
 type tickMsg time.Time
 
+// refreshMsg redraws the table while a poll is running
+type refreshMsg time.Time
+
+// refreshInterval is how often the resources are read while a poll is
+// running, so lists show up as they finish
+const refreshInterval = 500 * time.Millisecond
+
 type model struct {
-	monitor   *Monitor
-	config    Config
-	resources []*ResourceInfo
-	err       error
-	ready     bool
+	monitor      *Monitor
+	config       Config
+	resources    []*ResourceInfo
+	sortBy       string
+	cursor       int
+	detailKey    string
+	showManagers bool
+	hideStatus   bool
+	err          error
+	ready        bool
+	polling      bool       // a poll started by the model has not returned yet
+	notices      *noticeLog // alert output, shown below the table
 }
 
 func newModel(monitor *Monitor, config Config) model {
+	sortBy := config.SortBy
+	if sortBy == "" {
+		sortBy = SortByChanges
+	}
 	return model{
-		monitor: monitor,
-		config:  config,
+		monitor:    monitor,
+		config:     config,
+		sortBy:     sortBy,
+		hideStatus: config.HideStatusOnly,
+		polling:    true, // Init starts the first poll
 	}
 }
 
 func (m model) Init() tea.Cmd {
 	// Start polling immediately
-	return tea.Batch(
-		tickCmd(m.config.Interval),
-		doPoll(m.monitor),
-	)
+	return tea.Batch(doPoll(m.monitor), tickCmd(m.config.Interval), refreshCmd())
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -59,17 +81,76 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		}
 
+		if m.detailKey != "" {
+			switch msg.String() {
+			case "esc", "enter", "backspace":
+				m.detailKey = ""
+			}
+			return m, nil
+		}
+
+		if m.showManagers {
+			switch msg.String() {
+			case "m", "esc", "backspace":
+				m.showManagers = false
+			}
+			return m, nil
+		}
+
+		switch msg.String() {
+		case "m":
+			m.showManagers = true
+			return m, nil
+		case "s":
+			m.sortBy = nextSortKey(m.sortBy)
+			return m, nil
+		case "h":
+			m.hideStatus = !m.hideStatus
+			m.clampCursor()
+			return m, nil
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+			return m, nil
+		case "down", "j":
+			if m.cursor < len(m.rows())-1 {
+				m.cursor++
+			}
+			return m, nil
+		case "enter":
+			if rows := m.rows(); m.cursor < len(rows) {
+				m.detailKey = rows[m.cursor].Key()
+			}
+			return m, nil
+		}
+
 	case tickMsg:
-		// Poll on each tick
-		return m, tea.Batch(
-			tickCmd(m.config.Interval),
-			doPoll(m.monitor),
-		)
+		// Poll on each tick, unless the previous poll is still running so
+		// slow polls do not pile up
+		if m.polling {
+			return m, tickCmd(m.config.Interval)
+		}
+		m.polling = true
+		return m, tea.Batch(doPoll(m.monitor), tickCmd(m.config.Interval))
+
+	case refreshMsg:
+		// Show the lists that finished so far and the poll progress
+		if m.polling {
+			if resources := m.monitor.GetResources(); len(resources) > 0 || m.ready {
+				m.resources = resources
+				m.ready = true
+				m.clampCursor()
+			}
+		}
+		return m, refreshCmd()
 
 	case pollResultMsg:
 		m.resources = msg.resources
 		m.err = msg.err
 		m.ready = true
+		m.polling = false
+		m.clampCursor()
 		return m, nil
 
 	case tea.WindowSizeMsg:
@@ -88,47 +169,67 @@ func (m model) View() string {
 		return fmt.Sprintf("Error: %v\n\nPress 'q' to quit.\n", m.err)
 	}
 
+	if m.detailKey != "" {
+		return m.detailView()
+	}
+	if m.showManagers {
+		return m.managersView()
+	}
+
 	var b strings.Builder
 
 	// Title
 	b.WriteString(lipgloss.NewStyle().Bold(true).Render("Kubernetes Resource Monitor"))
 	b.WriteString("\n\n")
 
-	// Sort resources by changes(descending), resourceVersion (descending)
-	sortedResources := make([]*ResourceInfo, len(m.resources))
-	copy(sortedResources, m.resources)
-	sort.Slice(sortedResources, func(i, j int) bool {
-		if sortedResources[i].Changes != sortedResources[j].Changes {
-			return sortedResources[i].Changes > sortedResources[j].Changes
-		}
-		return sortedResources[i].ResourceVersion > sortedResources[j].ResourceVersion
-	})
-
-	// Limit to configured number of rows
-	if len(sortedResources) > m.config.Limit {
-		sortedResources = sortedResources[:m.config.Limit]
-	}
+	sortedResources := m.rows()
 
 	// Calculate column widths
+	contextWidth := 20
 	nameWidth := 30
 	typeWidth := 25
 	nsWidth := 20
 	versionWidth := 20
 	changesWidth := 10
+	classWidth := 8
+	rateWidth := 8
+	oscillationWidth := 18
+	managerWidth := 30
+
+	// Rows of several clusters are told apart by a context column
+	var contextHeader string
+	if m.config.multiCluster() {
+		contextHeader = fmt.Sprintf("%-*s ", contextWidth, "CONTEXT")
+	}
 
 	// Render table header
-	header := fmt.Sprintf("%-*s %-*s %-*s %-*s %-*s",
+	header := fmt.Sprintf("  %s%-*s %-*s %-*s %-*s %-*s %-*s %-*s %-*s %-*s %-*s %-*s %-*s %-*s",
+		contextHeader,
 		nameWidth, "NAME",
 		typeWidth, "TYPE",
 		nsWidth, "NAMESPACE",
 		versionWidth, "RESOURCE VERSION",
 		changesWidth, "CHANGES",
+		classWidth, "SPEC",
+		classWidth, "STATUS",
+		classWidth, "META",
+		rateWidth, "RATE 1M",
+		rateWidth, "RATE 5M",
+		rateWidth, "RATE 15M",
+		oscillationWidth, "OSCILLATION",
+		managerWidth, "MANAGER",
 	)
 	b.WriteString(headerStyle.Render(header))
 	b.WriteString("\n")
 
 	// Render table rows
-	for _, info := range sortedResources {
+	for i, info := range sortedResources {
+		if i == m.cursor {
+			b.WriteString("> ")
+		} else {
+			b.WriteString("  ")
+		}
+
 		name := truncate(info.Name, nameWidth)
 		resourceType := truncate(info.Type, typeWidth)
 		namespace := truncate(info.Namespace, nsWidth)
@@ -137,15 +238,26 @@ func (m model) View() string {
 		}
 		version := fmt.Sprintf("%d", info.ResourceVersion)
 		changes := fmt.Sprintf("%d", info.Changes)
+		var context string
+		if contextHeader != "" {
+			context = fmt.Sprintf("%-*s ", contextWidth, truncate(info.Context, contextWidth))
+		}
 
 		// Format the row
-		row := fmt.Sprintf("%-*s %-*s %-*s %-*s ",
+		row := fmt.Sprintf("%s%-*s %-*s %-*s %-*s ",
+			context,
 			nameWidth, name,
 			typeWidth, resourceType,
 			nsWidth, namespace,
 			versionWidth, version,
 		)
 
+		// Highlight resources on which an alert rule with the highlight
+		// action fires
+		if info.Highlight {
+			row = alertStyle.Render(row)
+		}
+
 		// Apply styling to delta if positive
 		if info.Changes > 0 {
 			deltaFormatted := changesStyle.Render(fmt.Sprintf("%-*s", changesWidth, changes))
@@ -156,23 +268,281 @@ func (m model) View() string {
 			b.WriteString(fmt.Sprintf("%-*s", changesWidth, changes))
 		}
 
+		b.WriteString(" ")
+		b.WriteString(fmt.Sprintf("%-*d %-*d %-*d ",
+			classWidth, info.SpecChanges,
+			classWidth, info.StatusChanges,
+			classWidth, info.MetadataChanges,
+		))
+		for _, rate := range []float64{info.Rate1m, info.Rate5m, info.Rate15m} {
+			cell := fmt.Sprintf("%-*s ", rateWidth, formatRate(rate))
+			if rate > 0 {
+				cell = changesStyle.Render(cell)
+			}
+			b.WriteString(cell)
+		}
+
+		oscillation := fmt.Sprintf("%-*s ", oscillationWidth, formatOscillation(info))
+		if info.Flapping {
+			oscillation = changesStyle.Render(oscillation)
+		}
+		b.WriteString(oscillation)
+
+		// Two managers fighting over fields are shown instead of the last
+		// manager, highlighted like a positive change count
+		if info.Fight != nil {
+			b.WriteString(changesStyle.Render(truncate(strings.Join(info.Fight.Managers, " vs "), managerWidth)))
+		} else {
+			b.WriteString(truncate(info.Manager, managerWidth))
+		}
+
 		b.WriteString("\n")
 	}
 
 	b.WriteString("\n")
-	b.WriteString(fmt.Sprintf("Showing top %d resources sorted by changes(DESC), resourceVersion(DESC)\n", len(sortedResources)))
-	b.WriteString(fmt.Sprintf("Polling interval: %d seconds\n", m.config.Interval))
-	b.WriteString("\nPress 'q' to quit.\n")
+	b.WriteString(fmt.Sprintf("Showing top %d resources sorted by %s\n", len(sortedResources), sortDescription(m.sortBy)))
+	if m.hideStatus {
+		b.WriteString("Hiding resources with status-only changes\n")
+	}
+	if m.config.Replay != "" || len(m.config.AuditLogs) > 0 {
+		b.WriteString(m.replayStatus() + "\n")
+	} else if m.config.Watch {
+		b.WriteString(fmt.Sprintf("Watching resources, refreshing every %d seconds\n", m.config.Interval))
+	} else {
+		b.WriteString(fmt.Sprintf("Polling interval: %d seconds\n", m.config.Interval))
+		b.WriteString(pollStatus(m.monitor.Stats()))
+	}
+	for _, cluster := range m.monitor.Clusters() {
+		if cluster.Err != nil {
+			b.WriteString(changesStyle.Render(fmt.Sprintf("Context %s: %v", cluster.Context, cluster.Err)) + "\n")
+		} else {
+			b.WriteString(fmt.Sprintf("Context %s: %d resources\n", cluster.Context, cluster.Resources))
+		}
+	}
+	if m.notices != nil {
+		for _, line := range m.notices.recent() {
+			b.WriteString(changesStyle.Render(truncate(line, 200)) + "\n")
+		}
+	}
+	b.WriteString("\nPress 's' to change sort order, 'h' to toggle status-only resources, up/down and enter to inspect a resource, 'm' to group by manager, 'q' to quit.\n")
 
 	return b.String()
 }
 
+// pollStatus describes the duration and concurrency of the last poll, and
+// how many lists are in flight if one is running
+func pollStatus(stats PollStats) string {
+	if stats.Polls == 0 && stats.InFlight == 0 {
+		return ""
+	}
+	status := fmt.Sprintf("First poll running with up to %d lists in flight", stats.PeakInFlight)
+	if stats.Polls > 0 {
+		status = fmt.Sprintf("Last poll took %s with up to %d lists in flight", stats.LastDuration.Round(time.Millisecond), stats.PeakInFlight)
+	}
+	if stats.InFlight > 0 {
+		status += fmt.Sprintf(", %d in flight now", stats.InFlight)
+	}
+	if stats.RequestErrors > 0 {
+		status += fmt.Sprintf(", %d request errors so far", stats.RequestErrors)
+	}
+	return status + "\n"
+}
+
+// replayStatus describes how far a replay of a recording or audit logs got
+func (m model) replayStatus() string {
+	start, current, end, done := m.monitor.ReplayProgress()
+
+	source := m.config.Replay
+	if len(m.config.AuditLogs) > 0 {
+		source = fmt.Sprintf("%d audit log(s)", len(m.config.AuditLogs))
+	}
+	if m.config.Speed == 0 {
+		return fmt.Sprintf("Showing %s from %s to %s", source,
+			start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"))
+	}
+
+	status := fmt.Sprintf("Replaying %s at %gx speed: %s of %s", source, m.config.Speed,
+		current.Format("2006-01-02 15:04:05"), end.Format("15:04:05"))
+	if done {
+		status += " (finished)"
+	}
+	return status
+}
+
+// clampCursor keeps the cursor on a shown row after the rows changed
+func (m *model) clampCursor() {
+	if rows := len(m.rows()); m.cursor >= rows {
+		m.cursor = max(rows-1, 0)
+	}
+}
+
+// rows returns the resources shown in the table
+func (m model) rows() []*ResourceInfo {
+	return selectRows(m.resources, m.sortBy, m.hideStatus, m.config.Limit)
+}
+
+// detailView shows the recent field-level diffs of the selected resource
+func (m model) detailView() string {
+	var info *ResourceInfo
+	for _, r := range m.resources {
+		if r.Key() == m.detailKey {
+			info = r
+			break
+		}
+	}
+	if info == nil {
+		return "The selected resource is no longer tracked.\n\nPress esc to go back, 'q' to quit.\n"
+	}
+
+	var b strings.Builder
+
+	namespace := info.Namespace
+	if namespace == "" {
+		namespace = "<cluster>"
+	}
+	title := fmt.Sprintf("%s %s/%s", info.Type, namespace, info.Name)
+	if info.Context != "" {
+		title += " in " + info.Context
+	}
+	b.WriteString(lipgloss.NewStyle().Bold(true).Render(title))
+	b.WriteString("\n\n")
+	b.WriteString(fmt.Sprintf("Resource version: %d\n", info.ResourceVersion))
+	b.WriteString(fmt.Sprintf("Changes: %d (%s, %s, %s over 1m, 5m, 15m)\n",
+		info.Changes, formatRate(info.Rate1m), formatRate(info.Rate5m), formatRate(info.Rate15m)))
+	b.WriteString(fmt.Sprintf("Spec changes: %d, status changes: %d, metadata changes: %d\n",
+		info.SpecChanges, info.StatusChanges, info.MetadataChanges))
+	b.WriteString(fmt.Sprintf("Last manager: %s\n", orAbsent(info.Manager)))
+	if len(info.Managers) > 0 {
+		b.WriteString(fmt.Sprintf("Updates by manager: %s\n", formatManagerCounts(info.Managers)))
+	}
+	if info.Oscillations > 0 {
+		line := fmt.Sprintf("Oscillations: %d, last returned to an earlier state after %s at %s",
+			info.Oscillations, info.Period.Round(time.Second), info.LastOscillation.Format("15:04:05"))
+		if info.Flapping {
+			line = changesStyle.Render("FLAPPING - " + line)
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	if len(info.Alerts) > 0 {
+		b.WriteString(changesStyle.Render(fmt.Sprintf("Alerts: %s", strings.Join(info.Alerts, ", "))))
+		b.WriteString("\n")
+	}
+	if info.Fight != nil {
+		b.WriteString(changesStyle.Render(fmt.Sprintf("Fight: %s keep taking over %s (last at %s)",
+			strings.Join(info.Fight.Managers, " and "), strings.Join(info.Fight.Fields, ", "), info.Fight.Time.Format("15:04:05"))))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	switch {
+	case m.config.Diffs <= 0:
+		b.WriteString("Diffs are not recorded. Start kflap with --diffs N to keep the last N diffs per resource.\n")
+	case len(info.Diffs) == 0:
+		b.WriteString("No changes recorded yet.\n")
+	}
+
+	for _, diff := range info.Diffs {
+		b.WriteString(headerStyle.Render(fmt.Sprintf("%s  resourceVersion %d", diff.Time.Format("15:04:05"), diff.ResourceVersion)))
+		b.WriteString("\n")
+		if len(diff.Changes) == 0 {
+			b.WriteString("  (only ignored fields changed)\n")
+		}
+		for _, change := range diff.Changes {
+			b.WriteString(fmt.Sprintf("  %s: %s → %s\n", change.Path, orAbsent(change.Old), changesStyle.Render(orAbsent(change.New))))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\nPress esc to go back, 'q' to quit.\n")
+
+	return b.String()
+}
+
+// managersView shows the updates of each field manager across all tracked
+// resources
+func (m model) managersView() string {
+	var b strings.Builder
+
+	b.WriteString(lipgloss.NewStyle().Bold(true).Render("Updates by Field Manager"))
+	b.WriteString("\n\n")
+
+	managerWidth := 40
+	countWidth := 10
+
+	header := fmt.Sprintf("%-*s %-*s %-*s %-*s",
+		managerWidth, "MANAGER",
+		countWidth, "UPDATES",
+		countWidth, "RESOURCES",
+		countWidth, "FIGHTS",
+	)
+	b.WriteString(headerStyle.Render(header))
+	b.WriteString("\n")
+
+	stats := AggregateManagers(m.resources)
+	if m.config.Limit > 0 && len(stats) > m.config.Limit {
+		stats = stats[:m.config.Limit]
+	}
+	for _, s := range stats {
+		b.WriteString(fmt.Sprintf("%-*s %-*d %-*d ",
+			managerWidth, truncate(s.Manager, managerWidth),
+			countWidth, s.Updates,
+			countWidth, s.Resources,
+		))
+		fights := fmt.Sprintf("%-*d", countWidth, s.Fights)
+		if s.Fights > 0 {
+			fights = changesStyle.Render(fights)
+		}
+		b.WriteString(fights)
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(fmt.Sprintf("Showing top %d managers sorted by updates(DESC)\n", len(stats)))
+	b.WriteString("\nPress 'm' or esc to go back, 'q' to quit.\n")
+
+	return b.String()
+}
+
+// formatManagerCounts renders update counts by manager, most updates first
+func formatManagerCounts(counts map[string]int64) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%d", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+func orAbsent(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
 func tickCmd(intervalSecs int) tea.Cmd {
 	return tea.Tick(time.Duration(intervalSecs)*time.Second, func(t time.Time) tea.Msg {
 		return tickMsg(t)
 	})
 }
 
+func refreshCmd() tea.Cmd {
+	return tea.Tick(refreshInterval, func(t time.Time) tea.Msg {
+		return refreshMsg(t)
+	})
+}
+
 type pollResultMsg struct {
 	resources []*ResourceInfo
 	err       error
@@ -189,6 +559,79 @@ func doPoll(monitor *Monitor) tea.Cmd {
 	}
 }
 
+// selectRows returns the resources to show: without status-only churn when
+// hideStatus is set, sorted by key (descending), then changes and
+// resourceVersion (descending), and limited to limit rows unless limit is 0
+func selectRows(resources []*ResourceInfo, key string, hideStatus bool, limit int) []*ResourceInfo {
+	rows := make([]*ResourceInfo, 0, len(resources))
+	for _, info := range resources {
+		if hideStatus && info.statusOnly() {
+			continue
+		}
+		rows = append(rows, info)
+	}
+	sortResources(rows, key)
+
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// sortResources orders resources by the value of key, then by changes and
+// resourceVersion, all descending
+func sortResources(resources []*ResourceInfo, key string) {
+	sort.Slice(resources, func(i, j int) bool {
+		if vi, vj := resources[i].sortValue(key), resources[j].sortValue(key); vi != vj {
+			return vi > vj
+		}
+		if resources[i].Changes != resources[j].Changes {
+			return resources[i].Changes > resources[j].Changes
+		}
+		return resources[i].ResourceVersion > resources[j].ResourceVersion
+	})
+}
+
+func sortDescription(key string) string {
+	switch key {
+	case SortByChanges:
+		return "changes(DESC), resourceVersion(DESC)"
+	case SortBySpec, SortByStatus, SortByMeta:
+		return fmt.Sprintf("%s changes(DESC), changes(DESC), resourceVersion(DESC)", key)
+	}
+	return fmt.Sprintf("%s rate(DESC), changes(DESC), resourceVersion(DESC)", key)
+}
+
+func nextSortKey(key string) string {
+	for i, k := range SortKeys {
+		if k == key {
+			return SortKeys[(i+1)%len(SortKeys)]
+		}
+	}
+	return SortKeys[0]
+}
+
+// formatOscillation renders the oscillation count and most recent period,
+// marked when the resource is currently flapping
+func formatOscillation(info *ResourceInfo) string {
+	if info.Oscillations == 0 {
+		return ""
+	}
+	summary := fmt.Sprintf("%dx/%s", info.Oscillations, info.Period.Round(time.Second))
+	if info.Flapping {
+		return "FLAPPING " + summary
+	}
+	return summary
+}
+
+// formatRate renders a per-minute change rate
+func formatRate(rate float64) string {
+	if rate == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%.1f/m", rate)
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
@@ -0,0 +1,154 @@
+package kflap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// pollWatches starts the watches on first use and afterwards only reports
+// whether starting them failed. In watch mode the resource map is updated
+// by informer events as they arrive rather than by Poll.
+func (m *Monitor) pollWatches() error {
+	m.watchOnce.Do(func() {
+		m.watchErr = m.startWatches()
+	})
+	return m.watchErr
+}
+
+// startWatches runs one informer per listable resource type, and per
+// namespace when namespaces are configured. Informers request watch
+// bookmarks and fall back to a fresh list when the API server answers
+// 410 Gone, so every resourceVersion bump seen on the watch stream is
+// counted and the state is resynchronised after an expired watch.
+func (m *Monitor) startWatches() error {
+	// Close may run concurrently when quitting during the first poll
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		cancel()
+		return fmt.Errorf("monitor closed")
+	}
+	m.cancel = cancel
+	m.mu.Unlock()
+
+	apiResources, err := m.discoverResources()
+	if err != nil {
+		return fmt.Errorf("error discovering resources: %v", err)
+	}
+
+	namespaces := m.config.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	for _, apiResource := range apiResources {
+		if !hasVerb(apiResource.Verbs, "watch") {
+			continue
+		}
+
+		gvr := schema.GroupVersionResource{
+			Group:    apiResource.Group,
+			Version:  apiResource.Version,
+			Resource: apiResource.Name,
+		}
+
+		if apiResource.Namespaced {
+			for _, ns := range namespaces {
+				m.startWatch(ctx, gvr, ns, apiResource.Kind)
+			}
+		} else {
+			m.startWatch(ctx, gvr, metav1.NamespaceAll, apiResource.Kind)
+		}
+	}
+
+	return nil
+}
+
+func (m *Monitor) startWatch(ctx context.Context, gvr schema.GroupVersionResource, namespace, kind string) {
+	selectors := func(opts *metav1.ListOptions) {
+		opts.LabelSelector = m.config.LabelSelector
+		opts.FieldSelector = m.config.FieldSelector
+	}
+
+	var informer cache.SharedIndexInformer
+	if m.config.FullObjects {
+		informer = dynamicinformer.NewFilteredDynamicInformer(m.dynamicClient, gvr, namespace, 0, cache.Indexers{}, selectors).Informer()
+	} else {
+		informer = metadatainformer.NewFilteredMetadataInformer(m.metadataClient, gvr, namespace, 0, cache.Indexers{}, selectors).Informer()
+	}
+
+	// Errors such as forbidden resources are counted and skipped like in
+	// poll mode; the informer keeps retrying with backoff. Expired and
+	// closed watches are routine and not counted.
+	_ = informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) || errors.Is(err, io.EOF) {
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.stats.RequestErrors++
+	})
+
+	_, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			m.observeObject(obj, gvr, kind)
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			m.observeObject(newObj, gvr, kind)
+		},
+	})
+
+	go informer.Run(ctx.Done())
+}
+
+// observeObject records the resourceVersion of an object delivered by an
+// informer
+func (m *Monitor) observeObject(obj interface{}, gvr schema.GroupVersionResource, kind string) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updateResourceInfo(gvr, kind, accessor)
+}
+
+// Close stops any running watches and closes the recording
+func (m *Monitor) Close() {
+	m.mu.Lock()
+	m.closed = true
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.mu.Unlock()
+
+	// Members share the recording, which is closed once below
+	for _, cluster := range m.clusters {
+		cluster.mu.Lock()
+		cluster.recorder = nil
+		cluster.mu.Unlock()
+		cluster.Close()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.recorder != nil {
+		if err := m.recorder.close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: error closing recording: %v\n", err)
+		}
+		m.recorder = nil
+	}
+}